@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -26,6 +27,11 @@ var (
 	logFile        string
 	noLogFile      bool
 	datadir        string
+	caDir          string
+	bodyRoot       string
+	injectTimeout  int
+	modulesDir     string
+	persistState   bool
 	impostersRepo  string
 	ipWhitelist    string
 	origin         []string
@@ -62,6 +68,11 @@ func main() {
 	startCmd.Flags().StringVar(&logFile, "logfile", "mb.log", "Log file location")
 	startCmd.Flags().BoolVar(&noLogFile, "nologfile", false, "Prevent logging to the filesystem")
 	startCmd.Flags().StringVar(&datadir, "datadir", "", "The directory to save imposters to")
+	startCmd.Flags().StringVar(&caDir, "caDir", "", "The directory to persist the local CA in (default ~/.mountebank/ca)")
+	startCmd.Flags().StringVar(&bodyRoot, "bodyRoot", "", "The directory bodyFile paths are relative to (default the config file's directory)")
+	startCmd.Flags().IntVar(&injectTimeout, "injectionTimeout", 0, "Milliseconds an injected script may run before it is interrupted (0 for no limit)")
+	startCmd.Flags().StringVar(&modulesDir, "modulesDir", "", "The directory injected scripts can require modules from")
+	startCmd.Flags().BoolVar(&persistState, "persistState", false, "Save script state with the imposters in the datadir or custom repository")
 	startCmd.Flags().StringVar(&ipWhitelist, "ipWhitelist", "*", "IP whitelist (pipe-delimited)")
 	startCmd.Flags().StringSliceVar(&origin, "origin", []string{}, "Allowed CORS origins")
 	startCmd.Flags().StringVar(&apiKey, "apikey", "", "API key for authentication")
@@ -206,6 +217,15 @@ func runStart(cmd *cobra.Command, args []string) {
 		LogConfig:      logConfig,
 		ImpostersRepo:  impostersRepo,
 		PidFile:        pidFile,
+		CADir:          caDir,
+		BodyRoot:       bodyRoot,
+
+		InjectionTimeout: injectTimeout,
+		ModulesDir:       modulesDir,
+		PersistState:     persistState,
+	}
+	if serverConfig.BodyRoot == "" && configFile != "" {
+		serverConfig.BodyRoot = filepath.Dir(configFile)
 	}
 
 	srv, err := server.New(serverConfig)
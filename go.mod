@@ -3,7 +3,9 @@ module github.com/mountebank-testing/mountebank-go
 go 1.21
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/antchfx/xmlquery v1.5.0
+	github.com/antchfx/xpath v1.3.5
 	github.com/dop251/goja v0.0.0-20251121114222-56b1242a5f86
 	github.com/gorilla/mux v1.8.1
 	github.com/oliveagle/jsonpath v0.0.0-20180606110733-2e52cf6e6852
@@ -15,7 +17,6 @@ require (
 )
 
 require (
-	github.com/antchfx/xpath v1.3.5 // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
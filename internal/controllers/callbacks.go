@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+)
+
+// GetCallbacks handles GET /imposters/:id/callbacks
+func (ic *ImposterController) GetCallbacks(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	writeCallbacks(w, imposter.Callbacks())
+}
+
+// ResetCallbacks handles DELETE /imposters/:id/callbacks
+func (ic *ImposterController) ResetCallbacks(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	imposter.ResetCallbacks()
+	writeCallbacks(w, imposter.Callbacks())
+}
+
+func writeCallbacks(w http.ResponseWriter, callbacks []models.CallbackRecord) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"callbacks": callbacks})
+}
@@ -192,7 +192,7 @@ func (ic *ImposterController) PostStub(w http.ResponseWriter, r *http.Request) {
 	}))
 }
 
-// DeleteStub handles DELETE /imposters/:id/stubs/:stubIndex
+// DeleteStub handles DELETE /imposters/:id/stubs/:stubId
 func (ic *ImposterController) DeleteStub(w http.ResponseWriter, r *http.Request) {
 	port, err := ic.getPortFromRequest(r)
 	if err != nil {
@@ -206,14 +206,13 @@ func (ic *ImposterController) DeleteStub(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	vars := mux.Vars(r)
-	stubIndex, err := strconv.Atoi(vars["stubIndex"])
+	stubID, err := stubIDFromRequest(imposter, r)
 	if err != nil {
-		util.WriteError(w, util.NewValidationError("invalid stub index", vars["stubIndex"]), http.StatusBadRequest)
+		util.WriteError(w, err, http.StatusNotFound)
 		return
 	}
 
-	if err := imposter.Stubs().DeleteAtIndex(stubIndex); err != nil {
+	if err := imposter.Stubs().DeleteByID(stubID); err != nil {
 		util.WriteError(w, err, http.StatusNotFound)
 		return
 	}
@@ -225,7 +224,7 @@ func (ic *ImposterController) DeleteStub(w http.ResponseWriter, r *http.Request)
 	}))
 }
 
-// PutStub handles PUT /imposters/:id/stubs/:stubIndex
+// PutStub handles PUT /imposters/:id/stubs/:stubId
 func (ic *ImposterController) PutStub(w http.ResponseWriter, r *http.Request) {
 	port, err := ic.getPortFromRequest(r)
 	if err != nil {
@@ -239,10 +238,9 @@ func (ic *ImposterController) PutStub(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	vars := mux.Vars(r)
-	stubIndex, err := strconv.Atoi(vars["stubIndex"])
+	stubID, err := stubIDFromRequest(imposter, r)
 	if err != nil {
-		util.WriteError(w, util.NewValidationError("invalid stub index", vars["stubIndex"]), http.StatusBadRequest)
+		util.WriteError(w, err, http.StatusNotFound)
 		return
 	}
 
@@ -252,8 +250,9 @@ func (ic *ImposterController) PutStub(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := imposter.Stubs().ReplaceAtIndex(stub, stubIndex); err != nil {
-		util.WriteError(w, err, http.StatusNotFound)
+	replace := func(models.Stub) (models.Stub, error) { return stub, nil }
+	if _, err := imposter.Stubs().UpdateByID(stubID, replace); err != nil {
+		util.WriteError(w, err, http.StatusBadRequest)
 		return
 	}
 
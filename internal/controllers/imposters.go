@@ -23,16 +23,26 @@ type ImpostersController struct {
 	logger         *util.Logger
 	allowInjection bool
 	debug          bool
+	ca             *util.LocalCA
+	bodyRoot       string
+
+	injectionTimeout int
+	modulesDir       string
 }
 
 // NewImpostersController creates a new imposters controller
-func NewImpostersController(repository *models.ImposterRepository, renderer *web.Renderer, logger *util.Logger, allowInjection bool, debug bool) *ImpostersController {
+func NewImpostersController(repository *models.ImposterRepository, renderer *web.Renderer, logger *util.Logger, allowInjection bool, debug bool, ca *util.LocalCA, bodyRoot string, injectionTimeout int, modulesDir string) *ImpostersController {
 	return &ImpostersController{
 		repository:     repository,
 		renderer:       renderer,
 		logger:         logger,
 		allowInjection: allowInjection,
 		debug:          debug,
+		ca:             ca,
+		bodyRoot:       bodyRoot,
+
+		injectionTimeout: injectionTimeout,
+		modulesDir:       modulesDir,
 	}
 }
 
@@ -44,7 +54,7 @@ func (ic *ImpostersController) createHTTPImposter(config *models.ImposterConfig,
 	var imposter *models.Imposter
 
 	// Create HTTP server
-	server, err := httpproto.Create(config, logger, func(request *models.Request, details map[string]interface{}) (*models.Response, error) {
+	server, err := httpproto.Create(config, logger, ic.ca, func(request *models.Request, details map[string]interface{}) (*models.Response, error) {
 		return imposter.GetResponseFor(request, details)
 	})
 	if err != nil {
@@ -73,7 +83,7 @@ func (ic *ImpostersController) createHTTPSImposter(config *models.ImposterConfig
 	var imposter *models.Imposter
 
 	// Create HTTPS server
-	server, err := httpsproto.Create(config, logger, func(request *models.Request, details map[string]interface{}) (*models.Response, error) {
+	server, err := httpsproto.Create(config, logger, ic.ca, func(request *models.Request, details map[string]interface{}) (*models.Response, error) {
 		return imposter.GetResponseFor(request, details)
 	})
 	if err != nil {
@@ -314,6 +324,14 @@ func (ic *ImpostersController) Put(w http.ResponseWriter, r *http.Request) {
 // createImposter creates an imposter based on protocol
 func (ic *ImpostersController) createImposter(config *models.ImposterConfig) (*models.Imposter, error) {
 	logger := ic.logger.WithScope(config.Protocol + ":" + string(rune(config.Port)))
+	config.BodyRoot = ic.bodyRoot
+	config.DefaultInjectionTimeout = ic.injectionTimeout
+	config.ModulesDir = ic.modulesDir
+	config.StateStore = ic.repository.State()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	switch config.Protocol {
 	case "http":
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// GetScenarios handles GET /imposters/:id/scenarios
+func (ic *ImposterController) GetScenarios(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	writeScenarios(w, imposter.Scenarios())
+}
+
+// ResetScenarios handles DELETE /imposters/:id/scenarios
+func (ic *ImposterController) ResetScenarios(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	writeScenarios(w, imposter.ResetScenarios())
+}
+
+// GetScenario handles GET /imposters/:id/scenarios/:name
+func (ic *ImposterController) GetScenario(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	scenario, err := imposter.Scenario(mux.Vars(r)["name"])
+	if err != nil {
+		util.WriteError(w, err, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scenario)
+}
+
+// ResetScenario handles DELETE /imposters/:id/scenarios/:name
+func (ic *ImposterController) ResetScenario(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	scenario, err := imposter.ResetScenario(mux.Vars(r)["name"])
+	if err != nil {
+		util.WriteError(w, err, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scenario)
+}
+
+// imposterFromRequest looks up the imposter named by the :id route
+// variable, writing an error response if there is none
+func (ic *ImposterController) imposterFromRequest(w http.ResponseWriter, r *http.Request) (*models.Imposter, bool) {
+	port, err := ic.getPortFromRequest(r)
+	if err != nil {
+		util.WriteError(w, err, http.StatusBadRequest)
+		return nil, false
+	}
+
+	imposter, err := ic.repository.Get(port)
+	if err != nil {
+		util.WriteError(w, util.NewMissingResourceError(err.Error(), port), http.StatusNotFound)
+		return nil, false
+	}
+	return imposter, true
+}
+
+func writeScenarios(w http.ResponseWriter, scenarios []models.Scenario) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"scenarios": scenarios})
+}
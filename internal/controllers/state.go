@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// GetState handles GET /state
+func (ic *ImpostersController) GetState(w http.ResponseWriter, r *http.Request) {
+	writeState(w, ic.repository.State().Global())
+}
+
+// PutState handles PUT /state
+func (ic *ImpostersController) PutState(w http.ResponseWriter, r *http.Request) {
+	replaceState(w, r, ic.repository.State().Global())
+}
+
+// DeleteState handles DELETE /state
+func (ic *ImpostersController) DeleteState(w http.ResponseWriter, r *http.Request) {
+	state := ic.repository.State().Global()
+	state.Clear()
+	writeState(w, state)
+}
+
+// GetState handles GET /imposters/:id/state
+func (ic *ImposterController) GetState(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	writeState(w, imposter.State())
+}
+
+// PutState handles PUT /imposters/:id/state
+func (ic *ImposterController) PutState(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	replaceState(w, r, imposter.State())
+}
+
+// DeleteState handles DELETE /imposters/:id/state
+func (ic *ImposterController) DeleteState(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	imposter.State().Clear()
+	writeState(w, imposter.State())
+}
+
+// replaceState replaces a namespace with the JSON object in the request body
+func replaceState(w http.ResponseWriter, r *http.Request, state *models.StateNamespace) {
+	var values map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		util.WriteError(w, util.NewInvalidJSONError(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	state.Replace(values)
+	writeState(w, state)
+}
+
+func writeState(w http.ResponseWriter, state *models.StateNamespace) {
+	values, err := state.Values()
+	if err != nil {
+		util.WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(values)
+}
@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// GetStub handles GET /imposters/:id/stubs/:stubId
+func (ic *ImposterController) GetStub(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	stubID, err := stubIDFromRequest(imposter, r)
+	if err != nil {
+		util.WriteError(w, err, http.StatusNotFound)
+		return
+	}
+
+	stub, _, err := imposter.Stubs().Get(stubID)
+	if err != nil {
+		util.WriteError(w, err, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imposter.StubWithLinks(stub))
+}
+
+// PatchStub handles PATCH /imposters/:id/stubs/:stubId, applying a JSON
+// merge patch (RFC 7396) to the stub
+func (ic *ImposterController) PatchStub(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	stubID, err := stubIDFromRequest(imposter, r)
+	if err != nil {
+		util.WriteError(w, err, http.StatusNotFound)
+		return
+	}
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		util.WriteError(w, util.NewInvalidJSONError(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	_, err = imposter.Stubs().UpdateByID(stubID, func(stub models.Stub) (models.Stub, error) {
+		var current map[string]interface{}
+		data, _ := json.Marshal(stub)
+		json.Unmarshal(data, &current)
+
+		var patched models.Stub
+		data, _ = json.Marshal(mergePatch(current, patch))
+		if err := json.Unmarshal(data, &patched); err != nil {
+			return stub, util.NewInvalidJSONError(err.Error())
+		}
+		patched.Links = nil
+		patched.IsProxy = stub.IsProxy
+		return patched, nil
+	})
+	if err != nil {
+		util.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imposter.ToJSON(map[string]interface{}{
+		"requests": true,
+		"stubs":    true,
+	}))
+}
+
+// MoveStub handles POST /imposters/:id/stubs/:stubId/move. The body gives
+// the new position as an index, or relative to another stub with before or
+// after.
+func (ic *ImposterController) MoveStub(w http.ResponseWriter, r *http.Request) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	stubID, err := stubIDFromRequest(imposter, r)
+	if err != nil {
+		util.WriteError(w, err, http.StatusNotFound)
+		return
+	}
+
+	var request struct {
+		Index  *int   `json:"index"`
+		Before string `json:"before"`
+		After  string `json:"after"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		util.WriteError(w, util.NewInvalidJSONError(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case request.Before != "" && request.After != "":
+		util.WriteError(w, util.NewValidationError("move takes only one of before or after", request), http.StatusBadRequest)
+		return
+	case request.Index != nil:
+		err = imposter.Stubs().Move(stubID, *request.Index)
+	case request.Before != "":
+		err = imposter.Stubs().MoveNextTo(stubID, request.Before, false)
+	case request.After != "":
+		err = imposter.Stubs().MoveNextTo(stubID, request.After, true)
+	default:
+		util.WriteError(w, util.NewValidationError("move requires index, before or after", nil), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if mbErr, ok := err.(*util.MountebankError); ok && mbErr.Code == util.MissingResourceError {
+			status = http.StatusNotFound
+		}
+		util.WriteError(w, err, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imposter.ToJSON(map[string]interface{}{
+		"requests": true,
+		"stubs":    true,
+	}))
+}
+
+// EnableStub handles POST /imposters/:id/stubs/:stubId/enable
+func (ic *ImposterController) EnableStub(w http.ResponseWriter, r *http.Request) {
+	ic.setStubEnabled(w, r, true)
+}
+
+// DisableStub handles POST /imposters/:id/stubs/:stubId/disable
+func (ic *ImposterController) DisableStub(w http.ResponseWriter, r *http.Request) {
+	ic.setStubEnabled(w, r, false)
+}
+
+// EnableStubs handles POST /imposters/:id/stubs/enable?tag=name
+func (ic *ImposterController) EnableStubs(w http.ResponseWriter, r *http.Request) {
+	ic.setTaggedStubsEnabled(w, r, true)
+}
+
+// DisableStubs handles POST /imposters/:id/stubs/disable?tag=name
+func (ic *ImposterController) DisableStubs(w http.ResponseWriter, r *http.Request) {
+	ic.setTaggedStubsEnabled(w, r, false)
+}
+
+// setStubEnabled enables or disables a single stub
+func (ic *ImposterController) setStubEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	stubID, err := stubIDFromRequest(imposter, r)
+	if err != nil {
+		util.WriteError(w, err, http.StatusNotFound)
+		return
+	}
+
+	imposter.Stubs().SetEnabled(func(stub *models.Stub) bool { return stub.ID == stubID }, enabled)
+
+	stub, _, err := imposter.Stubs().Get(stubID)
+	if err != nil {
+		util.WriteError(w, err, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imposter.StubWithLinks(stub))
+}
+
+// setTaggedStubsEnabled enables or disables every stub carrying one of the
+// tag query parameters
+func (ic *ImposterController) setTaggedStubsEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	imposter, ok := ic.imposterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tags := r.URL.Query()["tag"]
+	if len(tags) == 0 {
+		util.WriteError(w, util.NewValidationError("tag query parameter is required", nil), http.StatusBadRequest)
+		return
+	}
+
+	count := imposter.Stubs().SetEnabled(func(stub *models.Stub) bool {
+		for _, tag := range tags {
+			if stub.HasTag(tag) {
+				return true
+			}
+		}
+		return false
+	}, enabled)
+	if count == 0 {
+		util.WriteError(w, util.NewMissingResourceError("no stubs tagged "+strings.Join(tags, ", "), tags), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imposter.ToJSON(map[string]interface{}{
+		"requests": true,
+		"stubs":    true,
+	}))
+}
+
+// stubIDFromRequest resolves the :stubId route variable, which is a stub id
+// or, for compatibility, an array index
+func stubIDFromRequest(imposter *models.Imposter, r *http.Request) (string, error) {
+	ref := mux.Vars(r)["stubId"]
+	if imposter.Stubs().Has(ref) {
+		return ref, nil
+	}
+
+	if index, err := strconv.Atoi(ref); err == nil {
+		stubs := imposter.Stubs().GetAll()
+		if index >= 0 && index < len(stubs) {
+			return stubs[index].ID, nil
+		}
+		return "", util.NewValidationError("invalid stub index", ref)
+	}
+	return "", util.NewMissingResourceError("no stub with id "+ref, ref)
+}
+
+// mergePatch applies a JSON merge patch, where null removes a field
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+	for key, value := range patch {
+		switch v := value.(type) {
+		case nil:
+			delete(target, key)
+		case map[string]interface{}:
+			existing, _ := target[key].(map[string]interface{})
+			target[key] = mergePatch(existing, v)
+		default:
+			target[key] = v
+		}
+	}
+	return target
+}
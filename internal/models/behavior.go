@@ -1,10 +1,14 @@
 package models
 
 import (
+	"container/list"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/antchfx/xmlquery"
@@ -13,22 +17,49 @@ import (
 	"github.com/oliveagle/jsonpath"
 )
 
+// ErrWaitInterrupted is returned when a wait is cut short by Close
+var ErrWaitInterrupted = errors.New("wait interrupted: imposter stopped")
+
 // BehaviorExecutor executes response behaviors
 type BehaviorExecutor struct {
 	logger         *util.Logger
-	state          map[string]interface{}
+	state          ScriptState
 	allowInjection bool
+	random         *waitRandom
+	done           chan struct{}
+	closeOnce      sync.Once
+
+	// templates and templateOrder cache parsed templates, most recently
+	// used first
+	templateMu    sync.Mutex
+	templates     map[string]*list.Element
+	templateOrder *list.List
+	callbacks     *callbackRecorder
+	scripts       *ScriptEngine
 }
 
 // NewBehaviorExecutor creates a new behavior executor
-func NewBehaviorExecutor(logger *util.Logger, state map[string]interface{}, allowInjection bool) *BehaviorExecutor {
+func NewBehaviorExecutor(logger *util.Logger, state ScriptState, allowInjection bool, scripts *ScriptEngine) *BehaviorExecutor {
 	return &BehaviorExecutor{
 		logger:         logger,
 		state:          state,
 		allowInjection: allowInjection,
+		scripts:        scripts,
+		random:         newWaitRandom(),
+		done:           make(chan struct{}),
+		callbacks:      newCallbackRecorder(),
+		templates:      make(map[string]*list.Element),
+		templateOrder:  list.New(),
 	}
 }
 
+// Close interrupts any pending waits
+func (be *BehaviorExecutor) Close() {
+	be.closeOnce.Do(func() {
+		close(be.done)
+	})
+}
+
 // Execute executes all behaviors on a response
 func (be *BehaviorExecutor) Execute(request *Request, response *Response, behaviors []Behavior) (*Response, error) {
 	result := response
@@ -47,7 +78,7 @@ func (be *BehaviorExecutor) Execute(request *Request, response *Response, behavi
 // executeBehavior executes a single behavior
 func (be *BehaviorExecutor) executeBehavior(request *Request, response *Response, behavior Behavior) (*Response, error) {
 	if behavior.Wait != nil {
-		return be.executeWait(response, behavior.Wait)
+		return be.executeWait(request, response, behavior.Wait)
 	}
 
 	if behavior.Decorate != "" {
@@ -66,15 +97,108 @@ func (be *BehaviorExecutor) executeBehavior(request *Request, response *Response
 		return be.executeShellTransform(request, response, behavior.ShellTransform)
 	}
 
+	if behavior.Throttle != nil {
+		return be.executeThrottle(response, behavior.Throttle)
+	}
+
+	if behavior.Template != nil && !behavior.Template.disabled {
+		return be.executeTemplate(request, response, behavior.Template)
+	}
+
+	if behavior.Faker != nil {
+		return be.executeFaker(response, behavior.Faker)
+	}
+
+	if len(behavior.Callback) > 0 {
+		return be.executeCallback(request, response, behavior.Callback)
+	}
+
 	return response, nil
 }
 
+// validate checks the throttle when its stub is added, since the body is
+// only written after the response has started
+func (t *ThrottleBehavior) validate() error {
+	if t.BytesPerSecond != nil && *t.BytesPerSecond <= 0 {
+		return util.NewValidationError("throttle bytesPerSecond must be positive", t)
+	}
+	if t.ChunkSize != nil && *t.ChunkSize <= 0 {
+		return util.NewValidationError("throttle chunkSize must be positive", t)
+	}
+	if t.ChunkDelay < 0 || t.FirstByteDelay < 0 || (t.StallAfter != nil && *t.StallAfter < 0) {
+		return util.NewValidationError("throttle values must not be negative", t)
+	}
+	return nil
+}
+
+// executeThrottle marks the response to be written slowly by the protocol
+func (be *BehaviorExecutor) executeThrottle(response *Response, throttle *ThrottleBehavior) (*Response, error) {
+	// Copy so the stub's configured response is left untouched
+	throttled := *response
+	throttled.Throttle = throttle
+	return &throttled, nil
+}
+
 // executeWait adds latency to the response
-func (be *BehaviorExecutor) executeWait(response *Response, wait *WaitBehavior) (*Response, error) {
-	if wait.Milliseconds > 0 {
-		time.Sleep(time.Duration(wait.Milliseconds) * time.Millisecond)
+func (be *BehaviorExecutor) executeWait(request *Request, response *Response, wait *WaitBehavior) (*Response, error) {
+	var delay time.Duration
+	if wait.Fn != "" {
+		ms, err := be.evaluateWaitFn(request, wait.Fn)
+		if err != nil {
+			return nil, err
+		}
+		delay = time.Duration(ms * float64(time.Millisecond))
+	} else {
+		var err error
+		if delay, err = be.random.sample(wait); err != nil {
+			return nil, err
+		}
 	}
-	return response, nil
+
+	if delay <= 0 {
+		return response, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return response, nil
+	case <-be.done:
+		return nil, ErrWaitInterrupted
+	}
+}
+
+// evaluateWaitFn runs a JavaScript wait function returning milliseconds
+func (be *BehaviorExecutor) evaluateWaitFn(request *Request, code string) (float64, error) {
+	if !be.allowInjection {
+		return 0, fmt.Errorf("invalid injection: JavaScript injection is not allowed unless mb is run with the --allowInjection flag")
+	}
+
+	config := map[string]interface{}{
+		"request": be.requestToMap(request),
+	}
+
+	session := be.state.session()
+	defer session.close()
+
+	var ms float64
+	err := be.scripts.Run(fmt.Sprintf("(%s)(config)", code), session, func(vm *goja.Runtime) map[string]interface{} {
+		config["state"], config["globalState"] = session.objects(vm)
+		return map[string]interface{}{"config": config}
+	}, func(vm *goja.Runtime, val goja.Value) error {
+		ms = val.ToFloat()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("injection execution failed: %w", err)
+	}
+
+	if math.IsNaN(ms) || ms < 0 {
+		return 0, nil
+	}
+	return ms, nil
 }
 
 // executeDecorate modifies the response using JavaScript
@@ -83,8 +207,6 @@ func (be *BehaviorExecutor) executeDecorate(request *Request, response *Response
 		return nil, fmt.Errorf("invalid injection: JavaScript injection is not allowed unless mb is run with the --allowInjection flag")
 	}
 
-	vm := goja.New()
-
 	// Create JS-compatible logger
 	jsLogger := map[string]interface{}{
 		"debug": func(msg string, args ...interface{}) { be.logger.Debugf(msg, args...) },
@@ -98,43 +220,54 @@ func (be *BehaviorExecutor) executeDecorate(request *Request, response *Response
 		"request":  be.requestToMap(request),
 		"response": be.responseToMap(response),
 		"logger":   jsLogger,
-		"state":    be.state,
 	}
 
-	vm.Set("config", config)
-	vm.Set("logger", jsLogger)
-
-	// Wrap code in a function call
-	script := fmt.Sprintf("(%s)(config, config.response, logger)", code)
+	// Wrap code in a function call, passing callback for async decorators
+	script := fmt.Sprintf("(config.callback = callback, %s)(config, config.response, logger, callback)", code)
 
-	val, err := vm.RunString(script)
-	if err != nil {
-		be.logger.Errorf("Decorate error: %v", err)
-		return response, nil
-	}
+	session := be.state.session()
+	defer session.close()
 
-	// If the function returns a value, use it as the new response
-	// Otherwise, assume the response object in config was modified in place
 	var newResponseMap map[string]interface{}
-
-	if val != nil && !util.IsUndefined(val) && !util.IsNull(val) {
-		// Try to export as map
-		if exported, ok := val.Export().(map[string]interface{}); ok {
-			newResponseMap = exported
+	err := be.scripts.Run(script, session, func(vm *goja.Runtime) map[string]interface{} {
+		config["state"], config["globalState"] = session.objects(vm)
+		return map[string]interface{}{
+			"config": config,
+			"logger": jsLogger,
+			"faker":  newFakerObject(vm, defaultFaker),
+		}
+	}, func(vm *goja.Runtime, val goja.Value) error {
+		// If the function returns a value, use it as the new response
+		// Otherwise, assume the response object in config was modified in place
+		if val != nil && !util.IsUndefined(val) && !util.IsNull(val) {
+			// Try to export as map
+			if exported, ok := val.Export().(map[string]interface{}); ok {
+				newResponseMap = exported
+			}
 		}
-	}
 
-	// If no return value, check if config.response was modified in the VM
-	// We must re-export config from the VM to get changes made in JS
-	if newResponseMap == nil {
-		configVal := vm.Get("config")
-		if configVal != nil {
-			if exportedConfig, ok := configVal.Export().(map[string]interface{}); ok {
-				if respObj, ok := exportedConfig["response"].(map[string]interface{}); ok {
-					newResponseMap = respObj
+		// If no return value, check if config.response was modified in the VM
+		// We must re-export config from the VM to get changes made in JS
+		if newResponseMap == nil {
+			configVal := vm.Get("config")
+			if configVal != nil {
+				if exportedConfig, ok := configVal.Export().(map[string]interface{}); ok {
+					if respObj, ok := exportedConfig["response"].(map[string]interface{}); ok {
+						newResponseMap = respObj
+					}
 				}
 			}
 		}
+		return nil
+	})
+	if errors.Is(err, ErrScriptTimeout) {
+		// A runaway decorator fails the request rather than slipping through
+		// with an undecorated response
+		return nil, fmt.Errorf("injection execution failed: %w", err)
+	}
+	if err != nil {
+		be.logger.Errorf("Decorate error: %v", err)
+		return response, nil
 	}
 
 	if newResponseMap != nil {
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// maxCachedBodyFiles bounds how many body files an imposter keeps in
+// memory; the least recently used are dropped beyond it
+const maxCachedBodyFiles = 64
+
+// bodyFileCache holds the contents of body files that behaviors need in
+// memory, re-reading a file whenever its size or modification time changes
+type bodyFileCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type bodyFileEntry struct {
+	path     string
+	modTime  time.Time
+	size     int64
+	contents []byte
+}
+
+func newBodyFileCache() *bodyFileCache {
+	return &bodyFileCache{entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// load returns the current contents of the file
+func (c *bodyFileCache) load(path string, info os.FileInfo) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[path]; ok {
+		entry := element.Value.(*bodyFileEntry)
+		if entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+			c.order.MoveToFront(element)
+			return entry.contents, nil
+		}
+		c.order.Remove(element)
+		delete(c.entries, path)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[path] = c.order.PushFront(&bodyFileEntry{path: path, modTime: info.ModTime(), size: info.Size(), contents: contents})
+	if c.order.Len() > maxCachedBodyFiles {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*bodyFileEntry).path)
+	}
+	return contents, nil
+}
+
+// resolveBodyFile returns the absolute path of a bodyFile, which is relative
+// to root and must not escape it, symlinks included
+func resolveBodyFile(root, name string) (string, os.FileInfo, error) {
+	if root == "" {
+		root = "."
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", nil, err
+	}
+
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(absRoot, path)
+	}
+	path = filepath.Clean(path)
+
+	if !withinRoot(absRoot, path) {
+		return "", nil, util.NewValidationError("bodyFile must be within the body root", name)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", nil, fmt.Errorf("bodyFile not found: %s", name)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return "", nil, err
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil || !withinRoot(realRoot, realPath) {
+		return "", nil, util.NewValidationError("bodyFile must be within the body root", name)
+	}
+	return path, info, nil
+}
+
+// withinRoot reports whether path is root or lies beneath it
+func withinRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// withBodyFile returns a copy of the response pointing at the resolved body
+// file. The protocol streams the file unless behaviors need the contents,
+// in which case they are loaded into the body.
+func (imp *Imposter) withBodyFile(response *Response, load bool) (*Response, error) {
+	path, info, err := resolveBodyFile(imp.bodyRoot, response.BodyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := *response
+	resolved.BodyFile = path
+	resolved.Body = nil
+	if load {
+		contents, err := imp.bodyFiles.load(path, info)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Body = string(contents)
+	}
+	return &resolved, nil
+}
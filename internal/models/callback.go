@@ -0,0 +1,227 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// callbackTimeout bounds each callback attempt
+const callbackTimeout = 10 * time.Second
+
+// maxCallbackRecords is how many callbacks are kept; older ones are dropped
+const maxCallbackRecords = 1000
+
+// CallbackRecord describes a callback sent by a callback behavior
+type CallbackRecord struct {
+	Timestamp  string            `json:"timestamp"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	Attempts   int               `json:"attempts"`
+	StatusCode int               `json:"statusCode,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// callbackRecorder keeps the callbacks an imposter has sent
+type callbackRecorder struct {
+	mu      sync.Mutex
+	records []CallbackRecord
+	client  *http.Client
+}
+
+func newCallbackRecorder() *callbackRecorder {
+	return &callbackRecorder{
+		records: make([]CallbackRecord, 0),
+		client:  &http.Client{Timeout: callbackTimeout},
+	}
+}
+
+func (cr *callbackRecorder) add(record CallbackRecord) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if len(cr.records) >= maxCallbackRecords {
+		copy(cr.records, cr.records[1:])
+		cr.records = cr.records[:len(cr.records)-1]
+	}
+	cr.records = append(cr.records, record)
+}
+
+// Callbacks returns the most recent callbacks sent
+func (be *BehaviorExecutor) Callbacks() []CallbackRecord {
+	be.callbacks.mu.Lock()
+	defer be.callbacks.mu.Unlock()
+
+	return append([]CallbackRecord(nil), be.callbacks.records...)
+}
+
+// ResetCallbacks forgets the callbacks sent so far
+func (be *BehaviorExecutor) ResetCallbacks() {
+	be.callbacks.mu.Lock()
+	defer be.callbacks.mu.Unlock()
+
+	be.callbacks.records = make([]CallbackRecord, 0)
+}
+
+// executeCallback renders the callbacks against the request and response
+// and arranges for them to be sent once the response has been written
+func (be *BehaviorExecutor) executeCallback(request *Request, response *Response, callbacks CallbackList) (*Response, error) {
+	state, globalState := be.state.snapshot()
+	data := map[string]interface{}{
+		"request":     be.templateRequest(request),
+		"response":    be.responseToMap(response),
+		"state":       state,
+		"globalState": globalState,
+	}
+
+	pending := make([]CallbackRecord, 0, len(callbacks))
+	for _, callback := range callbacks {
+		record, err := be.renderCallback(callback, data)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, record)
+	}
+
+	// Copy so the stub's configured response is left untouched
+	withCallbacks := *response
+	previous := response.AfterSend
+	withCallbacks.AfterSend = func() {
+		if previous != nil {
+			previous()
+		}
+		for i := range pending {
+			go be.sendCallback(pending[i], callbacks[i])
+		}
+	}
+	return &withCallbacks, nil
+}
+
+// renderCallback renders the templated parts of a callback
+func (be *BehaviorExecutor) renderCallback(callback CallbackBehavior, data map[string]interface{}) (CallbackRecord, error) {
+	options := &TemplateBehavior{}
+	record := CallbackRecord{
+		Method:  strings.ToUpper(callback.Method),
+		Headers: make(map[string]string, len(callback.Headers)),
+	}
+	if record.Method == "" {
+		record.Method = http.MethodPost
+	}
+
+	var err error
+	if record.URL, err = be.renderString(callback.URL, data, options); err != nil {
+		return record, err
+	}
+	for name, value := range callback.Headers {
+		if record.Headers[name], err = be.renderString(value, data, options); err != nil {
+			return record, err
+		}
+	}
+
+	body, err := be.renderValue(callback.Body, data, options)
+	if err != nil {
+		return record, err
+	}
+	switch b := body.(type) {
+	case nil:
+	case string:
+		record.Body = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return record, err
+		}
+		record.Body = string(encoded)
+		if !hasHeader(record.Headers, "Content-Type") {
+			record.Headers["Content-Type"] = "application/json"
+		}
+	}
+	return record, nil
+}
+
+// sendCallback sends a rendered callback, retrying failures, and records
+// the outcome. Stopping the imposter abandons callbacks still waiting.
+func (be *BehaviorExecutor) sendCallback(record CallbackRecord, callback CallbackBehavior) {
+	if !sleepUntilDone(time.Duration(callback.Delay)*time.Millisecond, be.done) {
+		return
+	}
+
+	for {
+		record.Attempts++
+		record.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+		record.StatusCode, record.Error = 0, ""
+
+		statusCode, err := be.postCallback(record)
+		record.StatusCode = statusCode
+		if err != nil {
+			record.Error = err.Error()
+		} else if statusCode >= 500 {
+			record.Error = fmt.Sprintf("callback returned status %d", statusCode)
+		} else {
+			break
+		}
+
+		if record.Attempts > callback.Retries {
+			break
+		}
+		be.logger.Debugf("Callback to %s failed, retrying: %s", record.URL, record.Error)
+		if !sleepUntilDone(time.Duration(callback.RetryDelay)*time.Millisecond, be.done) {
+			return
+		}
+	}
+
+	if record.Error != "" {
+		be.logger.Warnf("Callback to %s failed after %d attempts: %s", record.URL, record.Attempts, record.Error)
+	}
+	be.callbacks.add(record)
+}
+
+// postCallback makes a single callback attempt
+func (be *BehaviorExecutor) postCallback(record CallbackRecord) (int, error) {
+	req, err := http.NewRequest(record.Method, record.URL, bytes.NewBufferString(record.Body))
+	if err != nil {
+		return 0, err
+	}
+	for name, value := range record.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := be.callbacks.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// sleepUntilDone sleeps for d, returning false if done closes first
+func sleepUntilDone(d time.Duration, done <-chan struct{}) bool {
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mountebank-testing/mountebank-go/internal/util"
 )
@@ -22,6 +23,12 @@ type DataStore interface {
 	
 	// DeleteAll removes all imposters from the store
 	DeleteAll() error
+
+	// LoadState loads the saved state namespaces, keyed by name
+	LoadState() (map[string]map[string]interface{}, error)
+
+	// SaveState persists a state namespace, removing it when values is empty
+	SaveState(namespace string, values map[string]interface{}) error
 }
 
 // NoOpDataStore is a data store that does nothing
@@ -31,6 +38,12 @@ func (s *NoOpDataStore) Load() ([]*ImposterConfig, error) { return nil, nil }
 func (s *NoOpDataStore) Save(imposter *Imposter) error    { return nil }
 func (s *NoOpDataStore) Delete(port int) error            { return nil }
 func (s *NoOpDataStore) DeleteAll() error                 { return nil }
+func (s *NoOpDataStore) LoadState() (map[string]map[string]interface{}, error) {
+	return nil, nil
+}
+func (s *NoOpDataStore) SaveState(namespace string, values map[string]interface{}) error {
+	return nil
+}
 
 // FileSystemDataStore implements DataStore using the filesystem
 type FileSystemDataStore struct {
@@ -115,7 +128,7 @@ func (s *FileSystemDataStore) Delete(port int) error {
 	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	return nil
+	return s.SaveState(fmt.Sprint(port), nil)
 }
 
 // DeleteAll removes all imposters from disk
@@ -137,5 +150,82 @@ func (s *FileSystemDataStore) DeleteAll() error {
 			}
 		}
 	}
+
+	// Imposter state goes with the imposters; global state stays
+	states, _ := os.ReadDir(s.stateDir())
+	for _, file := range states {
+		if file.Name() != GlobalStateNamespace+".json" {
+			filename := filepath.Join(s.stateDir(), file.Name())
+			if err := os.Remove(filename); err != nil {
+				s.logger.Errorf("Failed to remove state file %s: %v", filename, err)
+			}
+		}
+	}
 	return nil
 }
+
+// stateDir is where state namespaces are saved, one file each
+func (s *FileSystemDataStore) stateDir() string {
+	return filepath.Join(s.datadir, "state")
+}
+
+// LoadState loads the state namespaces saved in the datadir
+func (s *FileSystemDataStore) LoadState() (map[string]map[string]interface{}, error) {
+	if s.datadir == "" {
+		return nil, nil
+	}
+
+	files, err := os.ReadDir(s.stateDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	namespaces := make(map[string]map[string]interface{})
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		filename := filepath.Join(s.stateDir(), file.Name())
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			s.logger.Errorf("Failed to read state file %s: %v", filename, err)
+			continue
+		}
+
+		var values map[string]interface{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			s.logger.Errorf("Failed to parse state file %s: %v", filename, err)
+			continue
+		}
+		namespaces[strings.TrimSuffix(file.Name(), ".json")] = values
+	}
+	return namespaces, nil
+}
+
+// SaveState writes a state namespace to the datadir
+func (s *FileSystemDataStore) SaveState(namespace string, values map[string]interface{}) error {
+	if s.datadir == "" {
+		return nil
+	}
+
+	filename := filepath.Join(s.stateDir(), namespace+".json")
+	if len(values) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(s.stateDir(), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
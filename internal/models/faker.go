@@ -0,0 +1,372 @@
+package models
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+var (
+	fakerFirstNames = []string{
+		"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda",
+		"David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+		"Thomas", "Sarah", "Carlos", "Sofia", "Ahmed", "Fatima", "Wei", "Mei",
+		"Hiroshi", "Yuki", "Lukas", "Emma", "Mateo", "Lucia", "Olivia", "Noah",
+		"Liam", "Amelia", "Arjun", "Priya", "Ivan", "Anna", "Kwame", "Amara",
+	}
+	fakerLastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+		"Rodriguez", "Martinez", "Hernandez", "Lopez", "Wilson", "Anderson", "Taylor", "Thomas",
+		"Moore", "Jackson", "Martin", "Lee", "Thompson", "White", "Harris", "Clark",
+		"Lewis", "Walker", "Young", "Allen", "King", "Wright", "Müller", "Schmidt",
+		"Rossi", "Dubois", "Nakamura", "Chen", "Kumar", "Novak", "Okafor", "Silva",
+	}
+	fakerStreets = []string{
+		"Main Street", "Oak Avenue", "Maple Drive", "Cedar Lane", "Pine Road", "Elm Street",
+		"Washington Avenue", "Lake View Drive", "Hill Street", "Park Avenue", "Church Road",
+		"Station Road", "Mill Lane", "River Road", "Sunset Boulevard", "High Street",
+	}
+	fakerCities = []string{
+		"Springfield", "Riverside", "Fairview", "Franklin", "Greenville", "Bristol",
+		"Clinton", "Madison", "Georgetown", "Salem", "Arlington", "Ashland", "Dover",
+		"Oxford", "Milton", "Newport",
+	}
+	fakerCountries = []string{
+		"United States", "United Kingdom", "Germany", "France", "Spain", "Italy",
+		"Netherlands", "Canada", "Australia", "Japan", "Brazil", "India", "Mexico",
+		"Sweden", "Norway", "Ireland",
+	}
+	fakerDomains = []string{
+		"example.com", "example.org", "example.net", "mail.test", "inbox.test",
+	}
+	fakerLorem = []string{
+		"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit",
+		"sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore",
+		"magna", "aliqua", "enim", "ad", "minim", "veniam", "quis", "nostrud",
+		"exercitation", "ullamco", "laboris", "nisi", "aliquip", "ex", "ea", "commodo",
+		"consequat", "duis", "aute", "irure", "in", "reprehenderit", "voluptate",
+		"velit", "esse", "cillum", "fugiat", "nulla", "pariatur",
+	}
+
+	// fakerIBANFormats gives the BBAN layout per country, with A for an
+	// upper case letter and 9 for a digit
+	fakerIBANFormats = map[string]string{
+		"DE": "999999999999999999",
+		"GB": "AAAA99999999999999",
+		"NL": "AAAA9999999999",
+		"FR": "99999999999999999999999",
+		"ES": "99999999999999999999",
+		"IT": "A9999999999AAAAAAAAAAAA",
+		"BE": "999999999999",
+		"CH": "99999999999999999",
+	}
+)
+
+// fakerArguments names the positional arguments of the JavaScript faker
+// functions, so that faker.iban("GB") and faker.date(from, to) map onto
+// generator options
+var fakerArguments = map[string][]string{
+	"iban":      {"country"},
+	"date":      {"from", "to", "layout"},
+	"number":    {"min", "max"},
+	"words":     {"count"},
+	"sentence":  {"words"},
+	"paragraph": {"sentences"},
+	"lorem":     {"sentences"},
+}
+
+// fakerGenerators lists the generators available to behaviors, templates
+// and scripts
+var fakerGenerators = []string{
+	"firstName", "lastName", "name", "email", "phone", "street", "city", "zip",
+	"country", "address", "iban", "uuid", "word", "words", "sentence", "paragraph",
+	"lorem", "date", "number",
+}
+
+// defaultFaker serves unseeded generation
+var defaultFaker = NewFaker(time.Now().UnixNano())
+
+// Faker generates realistic fake data. A Faker created with the same seed
+// produces the same sequence of values.
+type Faker struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewFaker creates a faker seeded with seed
+func NewFaker(seed int64) *Faker {
+	return &Faker{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Generate returns a value from the named generator. Options configure
+// generators such as iban (country), date (from, to, layout), number
+// (min, max), words (count), sentence (words) and paragraph (sentences).
+func (f *Faker) Generate(kind string, options map[string]interface{}) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch kind {
+	case "firstName":
+		return f.pick(fakerFirstNames), nil
+	case "lastName":
+		return f.pick(fakerLastNames), nil
+	case "name":
+		return f.pick(fakerFirstNames) + " " + f.pick(fakerLastNames), nil
+	case "email":
+		user := strings.ToLower(f.pick(fakerFirstNames) + "." + f.pick(fakerLastNames))
+		return fmt.Sprintf("%s%d@%s", user, f.rng.Intn(100), f.pick(fakerDomains)), nil
+	case "phone":
+		return fmt.Sprintf("+1-%03d-%03d-%04d", 200+f.rng.Intn(800), 200+f.rng.Intn(800), f.rng.Intn(10000)), nil
+	case "street":
+		return fmt.Sprintf("%d %s", 1+f.rng.Intn(9999), f.pick(fakerStreets)), nil
+	case "city":
+		return f.pick(fakerCities), nil
+	case "zip":
+		return fmt.Sprintf("%05d", f.rng.Intn(100000)), nil
+	case "country":
+		return f.pick(fakerCountries), nil
+	case "address":
+		return fmt.Sprintf("%d %s, %s %05d, %s", 1+f.rng.Intn(9999), f.pick(fakerStreets),
+			f.pick(fakerCities), f.rng.Intn(100000), f.pick(fakerCountries)), nil
+	case "iban":
+		return f.iban(optionString(options, "country", "DE"))
+	case "uuid":
+		b := make([]byte, 16)
+		f.rng.Read(b)
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+	case "word":
+		return f.pick(fakerLorem), nil
+	case "words":
+		return f.words(optionInt(options, "count", 3)), nil
+	case "sentence":
+		return f.sentence(optionInt(options, "words", 8)), nil
+	case "paragraph", "lorem":
+		sentences := make([]string, maxInt(optionInt(options, "sentences", 3), 0))
+		for i := range sentences {
+			sentences[i] = f.sentence(5 + f.rng.Intn(8))
+		}
+		return strings.Join(sentences, " "), nil
+	case "date":
+		return f.date(options)
+	case "number":
+		min, max := optionInt(options, "min", 0), optionInt(options, "max", 100)
+		if max < min {
+			return "", fmt.Errorf("faker number max must not be less than min")
+		}
+		return fmt.Sprint(min + f.rng.Intn(max-min+1)), nil
+	}
+	return "", fmt.Errorf("unknown faker generator: %s", kind)
+}
+
+func (f *Faker) pick(values []string) string {
+	return values[f.rng.Intn(len(values))]
+}
+
+func (f *Faker) words(count int) string {
+	words := make([]string, maxInt(count, 0))
+	for i := range words {
+		words[i] = f.pick(fakerLorem)
+	}
+	return strings.Join(words, " ")
+}
+
+func (f *Faker) sentence(count int) string {
+	if count <= 0 {
+		return ""
+	}
+	words := f.words(count)
+	return strings.ToUpper(words[:1]) + words[1:] + "."
+}
+
+// iban generates an IBAN with valid check digits for the country
+func (f *Faker) iban(country string) (string, error) {
+	country = strings.ToUpper(country)
+	format, ok := fakerIBANFormats[country]
+	if !ok {
+		return "", fmt.Errorf("unsupported faker iban country: %s", country)
+	}
+
+	bban := make([]byte, len(format))
+	for i, c := range format {
+		if c == 'A' {
+			bban[i] = byte('A' + f.rng.Intn(26))
+		} else {
+			bban[i] = byte('0' + f.rng.Intn(10))
+		}
+	}
+
+	// ISO 13616: move the country and 00 to the end, turn letters into
+	// numbers and take 98 minus the remainder modulo 97
+	var digits strings.Builder
+	for _, c := range string(bban) + country + "00" {
+		if c >= 'A' && c <= 'Z' {
+			digits.WriteString(fmt.Sprint(c - 'A' + 10))
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+	number, _ := new(big.Int).SetString(digits.String(), 10)
+	check := 98 - new(big.Int).Mod(number, big.NewInt(97)).Int64()
+
+	return fmt.Sprintf("%s%02d%s", country, check, bban), nil
+}
+
+// date returns a date between from and to, formatted like from unless a
+// layout is given
+func (f *Faker) date(options map[string]interface{}) (string, error) {
+	from, layout, err := parseFakerDate(optionString(options, "from", "2000-01-01"))
+	if err != nil {
+		return "", err
+	}
+	to, _, err := parseFakerDate(optionString(options, "to", time.Now().UTC().Format("2006-01-02")))
+	if err != nil {
+		return "", err
+	}
+	if to.Before(from) {
+		return "", fmt.Errorf("faker date to must not be before from")
+	}
+	if custom := optionString(options, "layout", ""); custom != "" {
+		layout = custom
+	}
+
+	span := to.Sub(from)
+	offset := time.Duration(0)
+	if span > 0 {
+		offset = time.Duration(f.rng.Int63n(int64(span)))
+	}
+	return from.Add(offset).Format(layout), nil
+}
+
+// parseFakerDate accepts dates and RFC3339 timestamps
+func parseFakerDate(value string) (time.Time, string, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, layout, nil
+		}
+	}
+	return time.Time{}, "", fmt.Errorf("invalid faker date: %s", value)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func optionString(options map[string]interface{}, name, fallback string) string {
+	if value, ok := options[name]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return fallback
+}
+
+func optionInt(options map[string]interface{}, name string, fallback int) int {
+	if value, ok := options[name]; ok && value != nil {
+		return int(toFloat(value))
+	}
+	return fallback
+}
+
+// newFakerObject exposes a faker to scripts as an object with one function
+// per generator, plus seed(n) to switch to a reproducible sequence
+func newFakerObject(vm *goja.Runtime, faker *Faker) *goja.Object {
+	obj := vm.NewObject()
+	for _, kind := range fakerGenerators {
+		kind := kind
+		obj.Set(kind, func(call goja.FunctionCall) goja.Value {
+			options := make(map[string]interface{})
+			for i, name := range fakerArguments[kind] {
+				if arg := call.Argument(i); !goja.IsUndefined(arg) {
+					options[name] = arg.Export()
+				}
+			}
+
+			value, err := faker.Generate(kind, options)
+			if err != nil {
+				panic(vm.NewGoError(err))
+			}
+			return vm.ToValue(value)
+		})
+	}
+	obj.Set("seed", func(seed int64) {
+		faker = NewFaker(seed)
+	})
+	return obj
+}
+
+// compile checks every generator the behavior names, with its options,
+// when the stub is added. Seeded behaviors get their own faker so that the
+// sequence of values is reproducible; it lives as long as the stub does.
+func (f *FakerBehavior) compile() error {
+	scratch := NewFaker(0)
+	for _, spec := range f.Into {
+		kind, options := fakerSpec(spec)
+		if _, err := scratch.Generate(kind, options); err != nil {
+			return util.NewValidationError(err.Error(), spec)
+		}
+	}
+
+	if f.Seed != nil {
+		f.seeded = NewFaker(*f.Seed)
+	}
+	f.compiled = true
+	return nil
+}
+
+// fakerSpec reads a token's generator, given either by name or as an object
+// with a type and options
+func fakerSpec(spec interface{}) (string, map[string]interface{}) {
+	switch spec := spec.(type) {
+	case string:
+		return spec, nil
+	case map[string]interface{}:
+		kind, _ := spec["type"].(string)
+		return kind, spec
+	}
+	return "", nil
+}
+
+// executeFaker replaces tokens in the response with generated values
+func (be *BehaviorExecutor) executeFaker(response *Response, behavior *FakerBehavior) (*Response, error) {
+	faker := defaultFaker
+	if behavior.seeded != nil {
+		faker = behavior.seeded
+	}
+
+	// Copy so the stub's configured response is left untouched
+	generated := *response
+	if response.Headers != nil {
+		generated.Headers = make(map[string]interface{}, len(response.Headers))
+		for name, value := range response.Headers {
+			generated.Headers[name] = value
+		}
+	}
+
+	// Generate in token order so seeded values are reproducible
+	tokens := make([]string, 0, len(behavior.Into))
+	for token := range behavior.Into {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+
+	for _, token := range tokens {
+		kind, options := fakerSpec(behavior.Into[token])
+		value, err := faker.Generate(kind, options)
+		if err != nil {
+			return nil, err
+		}
+		be.injectValue(&generated, token, value)
+	}
+
+	return &generated, nil
+}
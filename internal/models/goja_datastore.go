@@ -2,9 +2,11 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/mountebank-testing/mountebank-go/internal/util"
@@ -12,14 +14,18 @@ import (
 
 // GojaDataStore implements DataStore using a JavaScript module
 type GojaDataStore struct {
-	vm     *goja.Runtime
-	repo   *goja.Object
-	logger *util.Logger
-	mu     sync.Mutex
+	vm      *goja.Runtime
+	repo    *goja.Object
+	timeout time.Duration
+	logger  *util.Logger
+	mu      sync.Mutex
 }
 
-// NewGojaDataStore creates a new Goja data store
-func NewGojaDataStore(path string, logger *util.Logger) (*GojaDataStore, error) {
+// NewGojaDataStore creates a new Goja data store. The repository can
+// require the built-in modules and modules in modulesDir, and each call,
+// waiting on its promise included, fails with ErrScriptTimeout after
+// timeout; zero means no limit.
+func NewGojaDataStore(path string, modulesDir string, timeout time.Duration, logger *util.Logger) (*GojaDataStore, error) {
 	vm := goja.New()
 
 	// Mock module.exports
@@ -29,10 +35,7 @@ func NewGojaDataStore(path string, logger *util.Logger) (*GojaDataStore, error)
 	vm.Set("module", module)
 	vm.Set("exports", exports)
 
-	// Mock require (basic)
-	vm.Set("require", func(call goja.FunctionCall) goja.Value {
-		return goja.Undefined()
-	})
+	newModuleLoader(modulesDir).install(vm)
 
 	// Read JS file
 	script, err := os.ReadFile(path)
@@ -67,15 +70,16 @@ func NewGojaDataStore(path string, logger *util.Logger) (*GojaDataStore, error)
 	}
 
 	// Call create(config)
-	repoVal, err := create(goja.Undefined(), vm.ToValue(config))
+	repoVal, err := callRepository(vm, timeout, create, goja.Undefined(), vm.ToValue(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create repository: %v", err)
 	}
 
 	return &GojaDataStore{
-		vm:     vm,
-		repo:   repoVal.ToObject(vm),
-		logger: logger,
+		vm:      vm,
+		repo:    repoVal.ToObject(vm),
+		timeout: timeout,
+		logger:  logger,
 	}, nil
 }
 
@@ -101,23 +105,12 @@ func (s *GojaDataStore) Load() ([]*ImposterConfig, error) {
 		}
 	}
 
-	res, err := load(s.repo)
+	// Promises returned by the repository are resolved before converting
+	res, err := callRepository(s.vm, s.timeout, load, s.repo)
 	if err != nil {
 		return nil, err
 	}
 
-	// Handle Promise if returned
-	if promise, ok := res.Export().(*goja.Promise); ok {
-		// Goja doesn't expose Promise result easily synchronously?
-		// We might need to wait.
-		// For now, assume sync or simple object.
-		// If it's a promise, we are in trouble without an event loop.
-		// But let's assume the user provides a sync implementation or we handle simple values.
-		// Actually, if it returns a Promise, we can't get value easily.
-		// We'll assume it returns the value directly for this implementation.
-		_ = promise
-	}
-
 	// Convert result to []*ImposterConfig
 	var configs []*ImposterConfig
 
@@ -147,7 +140,7 @@ func (s *GojaDataStore) Save(imposter *Imposter) error {
 	}
 
 	info := imposter.ToJSON(nil)
-	_, err := add(s.repo, s.vm.ToValue(info))
+	_, err := callRepository(s.vm, s.timeout, add, s.repo, s.vm.ToValue(info))
 	return err
 }
 
@@ -166,7 +159,7 @@ func (s *GojaDataStore) Delete(port int) error {
 		}
 	}
 
-	_, err := del(s.repo, s.vm.ToValue(port))
+	_, err := callRepository(s.vm, s.timeout, del, s.repo, s.vm.ToValue(port))
 	return err // Ignore result imposter
 }
 
@@ -181,6 +174,64 @@ func (s *GojaDataStore) DeleteAll() error {
 		return fmt.Errorf("repository missing 'deleteAll' function")
 	}
 
-	_, err := delAll(s.repo)
+	_, err := callRepository(s.vm, s.timeout, delAll, s.repo)
+	return err
+}
+
+// LoadState loads saved state through the repository's optional loadState
+// function
+func (s *GojaDataStore) LoadState() (map[string]map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loadState, ok := goja.AssertFunction(s.repo.Get("loadState"))
+	if !ok {
+		return nil, nil
+	}
+
+	res, err := callRepository(s.vm, s.timeout, loadState, s.repo)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonBytes, err := json.Marshal(res.Export())
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces map[string]map[string]interface{}
+	if err := json.Unmarshal(jsonBytes, &namespaces); err != nil {
+		return nil, err
+	}
+	return namespaces, nil
+}
+
+// SaveState persists a state namespace through the repository's optional
+// saveState function
+func (s *GojaDataStore) SaveState(namespace string, values map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saveState, ok := goja.AssertFunction(s.repo.Get("saveState"))
+	if !ok {
+		return nil
+	}
+
+	_, err := callRepository(s.vm, s.timeout, saveState, s.repo, s.vm.ToValue(namespace), s.vm.ToValue(values))
 	return err
 }
+
+// callRepository calls a repository function, waiting for the promise it
+// returns, if any, to settle within timeout
+func callRepository(vm *goja.Runtime, timeout time.Duration, fn goja.Callable, this goja.Value, args ...goja.Value) (goja.Value, error) {
+	expired, stop := interruptAfter(vm, timeout)
+	defer stop()
+
+	result, err := runAsync(vm, expired, nil, func() (goja.Value, error) {
+		return fn(this, args...)
+	})
+	if errors.Is(err, ErrScriptTimeout) {
+		return nil, ErrScriptTimeout
+	}
+	return result, err
+}
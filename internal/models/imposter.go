@@ -3,7 +3,10 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/mountebank-testing/mountebank-go/internal/util"
 )
@@ -15,7 +18,7 @@ type Imposter struct {
 	name               string
 	stubs              *StubRepository
 	logger             *util.Logger
-	state              map[string]interface{}
+	state              ScriptState
 	numberOfRequests   int
 	recordRequests     bool
 	closeFunc          func(func()) error
@@ -23,6 +26,7 @@ type Imposter struct {
 	mu                 sync.RWMutex
 	predicateEvaluator *PredicateEvaluator
 	behaviorExecutor   *BehaviorExecutor
+	scripts            *ScriptEngine
 	defaultResponse    *Response
 	middleware         string
 	allowInjection     bool
@@ -32,29 +36,45 @@ type Imposter struct {
 	allowCORS  bool
 	key        string
 	cert       string
+	ca         string
 	mutualAuth bool
 	mode       string
 	host       string
+
+	compressResponses bool
+	forwardProxy      *ForwardProxyConfig
+	virtualHosts      []*virtualHost
+	tls               *TLSOptions
+	injectionTimeout  *int
+	bodyRoot          string
+	bodyFiles         *bodyFileCache
+	scenarios         *ScenarioStore
 }
 
 // ImposterInfo contains information about an imposter
 type ImposterInfo struct {
-	Port             int                    `json:"port"`
-	Protocol         string                 `json:"protocol"`
-	Name             string                 `json:"name,omitempty"`
-	NumberOfRequests *int                   `json:"numberOfRequests,omitempty"`
-	RecordRequests   bool                   `json:"recordRequests"`
-	Requests         *[]*Request            `json:"requests,omitempty"`
-	Stubs            *[]Stub                `json:"stubs,omitempty"`
-	Middleware       string                 `json:"middleware,omitempty"`
-	DefaultResponse  *Response              `json:"defaultResponse,omitempty"`
-	AllowCORS        bool                   `json:"allowCORS,omitempty"`
-	Key              string                 `json:"key,omitempty"`
-	Cert             string                 `json:"cert,omitempty"`
-	MutualAuth       bool                   `json:"mutualAuth,omitempty"`
-	Mode             string                 `json:"mode,omitempty"`
-	Host             string                 `json:"host,omitempty"`
-	Links            map[string]interface{} `json:"_links,omitempty"`
+	Port              int                    `json:"port"`
+	Protocol          string                 `json:"protocol"`
+	Name              string                 `json:"name,omitempty"`
+	NumberOfRequests  *int                   `json:"numberOfRequests,omitempty"`
+	RecordRequests    bool                   `json:"recordRequests"`
+	Requests          *[]*Request            `json:"requests,omitempty"`
+	Stubs             *[]Stub                `json:"stubs,omitempty"`
+	Middleware        string                 `json:"middleware,omitempty"`
+	DefaultResponse   *Response              `json:"defaultResponse,omitempty"`
+	AllowCORS         bool                   `json:"allowCORS,omitempty"`
+	Key               string                 `json:"key,omitempty"`
+	Cert              string                 `json:"cert,omitempty"`
+	CA                string                 `json:"ca,omitempty"`
+	MutualAuth        bool                   `json:"mutualAuth,omitempty"`
+	CompressResponses bool                   `json:"compressResponses,omitempty"`
+	ForwardProxy      *ForwardProxyConfig    `json:"forwardProxy,omitempty"`
+	VirtualHosts      []VirtualHost          `json:"virtualHosts,omitempty"`
+	TLS               *TLSOptions            `json:"tls,omitempty"`
+	InjectionTimeout  *int                   `json:"injectionTimeout,omitempty"`
+	Mode              string                 `json:"mode,omitempty"`
+	Host              string                 `json:"host,omitempty"`
+	Links             map[string]interface{} `json:"_links,omitempty"`
 }
 
 // Link represents a hypermedia link
@@ -64,12 +84,12 @@ type Link struct {
 
 // NewImposter creates a new imposter
 func NewImposter(config *ImposterConfig, logger *util.Logger, allowInjection bool, closeFunc func(func()) error, saveFunc func(*Imposter) error) *Imposter {
-	state := make(map[string]interface{})
-	encoding := "utf8"
-
-	if config.Mode == "binary" {
-		encoding = "base64"
+	stateStore := config.StateStore
+	if stateStore == nil {
+		stateStore = NewStateStore()
 	}
+	state := stateStore.ForScripts(config.Port)
+	encoding := config.Encoding()
 
 	imp := &Imposter{
 		port:             config.Port,
@@ -88,9 +108,18 @@ func NewImposter(config *ImposterConfig, logger *util.Logger, allowInjection boo
 		allowCORS:        config.AllowCORS,
 		key:              config.Key,
 		cert:             config.Cert,
+		ca:               config.CA,
 		mutualAuth:       config.MutualAuth,
 		mode:             config.Mode,
 		host:             config.Host,
+
+		compressResponses: config.CompressResponses,
+		forwardProxy:      config.ForwardProxy,
+		tls:               config.TLS,
+		injectionTimeout:  config.InjectionTimeout,
+		bodyRoot:          config.BodyRoot,
+		bodyFiles:         newBodyFileCache(),
+		scenarios:         NewScenarioStore(),
 	}
 
 	onUpdate := func() {
@@ -101,11 +130,32 @@ func NewImposter(config *ImposterConfig, logger *util.Logger, allowInjection boo
 		}
 	}
 
-	stubs := NewStubRepository(config.Stubs, config.Requests, logger, onUpdate)
+	stubs := NewStubRepository(config.Stubs, config.Requests, encoding, logger, onUpdate)
 	imp.stubs = stubs
 
-	imp.predicateEvaluator = NewPredicateEvaluator(encoding, logger, state, allowInjection)
-	imp.behaviorExecutor = NewBehaviorExecutor(logger, state, allowInjection)
+	for _, vh := range config.VirtualHosts {
+		imp.virtualHosts = append(imp.virtualHosts, &virtualHost{
+			host:            vh.Host,
+			stubs:           NewStubRepository(vh.Stubs, nil, encoding, logger, onUpdate),
+			defaultResponse: vh.DefaultResponse,
+			key:             vh.Key,
+			cert:            vh.Cert,
+		})
+	}
+
+	timeout := config.DefaultInjectionTimeout
+	if config.InjectionTimeout != nil {
+		timeout = *config.InjectionTimeout
+	}
+	imp.scripts = NewScriptEngine(ScriptOptions{
+		Runtimes: defaultScriptRuntimes,
+		Timeout:  time.Duration(timeout) * time.Millisecond,
+		Name:     strconv.Itoa(config.Port),
+
+		ModulesDir: config.ModulesDir,
+	})
+	imp.predicateEvaluator = NewPredicateEvaluator(encoding, logger, state, allowInjection, imp.scripts)
+	imp.behaviorExecutor = NewBehaviorExecutor(logger, state, allowInjection, imp.scripts)
 
 	return imp
 }
@@ -122,7 +172,7 @@ func (imp *Imposter) GetResponseFor(request *Request, requestDetails map[string]
 	}
 
 	// Execute middleware
-	middlewareResponse, err := imp.executeMiddleware(request)
+	request, middlewareResponse, err := imp.executeMiddleware(request)
 	if err != nil {
 		return nil, err
 	}
@@ -130,15 +180,23 @@ func (imp *Imposter) GetResponseFor(request *Request, requestDetails map[string]
 		return middlewareResponse, nil
 	}
 
-	// Find matching stub
-	match, err := imp.findFirstMatch(request)
+	// Find matching stub, within the virtual host the request was sent to
+	stubs, defaultResponse := imp.stubs, imp.defaultResponse
+	if vh := imp.virtualHostFor(request); vh != nil {
+		stubs, defaultResponse = vh.stubs, vh.defaultResponse
+	}
+
+	match, err := imp.findFirstMatch(stubs, request)
 	if err != nil {
 		return nil, err
 	}
 
 	if !match.Success {
-		if imp.defaultResponse != nil {
-			return imp.defaultResponse, nil
+		if defaultResponse != nil && defaultResponse.BodyFile != "" {
+			return imp.withBodyFile(defaultResponse, false)
+		}
+		if defaultResponse != nil {
+			return defaultResponse, nil
 		}
 		// Default to 200 OK empty body if no defaultResponse configured
 		return &Response{StatusCode: 200}, nil
@@ -159,23 +217,45 @@ func (imp *Imposter) GetResponseFor(request *Request, requestDetails map[string]
 	return response, nil
 }
 
-// findFirstMatch finds the first stub that matches the request
-func (imp *Imposter) findFirstMatch(request *Request) (*StubMatch, error) {
-	filter := func(predicates []Predicate) bool {
-		if len(predicates) == 0 {
-			return true
-		}
+// virtualHostFor returns the virtual host serving a request, if any
+func (imp *Imposter) virtualHostFor(request *Request) *virtualHost {
+	if len(imp.virtualHosts) == 0 {
+		return nil
+	}
 
-		for _, predicate := range predicates {
-			if !imp.predicateEvaluator.Evaluate(predicate, request) {
-				return false
-			}
+	patterns := make([]string, len(imp.virtualHosts))
+	for i, vh := range imp.virtualHosts {
+		patterns[i] = vh.host
+	}
+
+	if i := FindVirtualHost(patterns, requestHost(request)); i >= 0 {
+		return imp.virtualHosts[i]
+	}
+	return nil
+}
+
+// findFirstMatch finds the first stub that matches the request, failing
+// when a predicate script runs away
+func (imp *Imposter) findFirstMatch(stubs *StubRepository, request *Request) (*StubMatch, error) {
+	ctx := imp.predicateEvaluator.newMatchContext(request)
+	filter := func(stub *Stub) bool {
+		if !imp.scenarioMatches(stub) {
+			return false
 		}
 
-		return true
+		return imp.predicateEvaluator.matchStub(stub, ctx)
 	}
 
-	return imp.stubs.First(filter)
+	// Binary imposters decode predicate values, which the index does not
+	indexed := request
+	if imp.encoding == "base64" {
+		indexed = nil
+	}
+	match, err := stubs.First(indexed, filter, imp.claimScenario)
+	if err == nil && ctx.err != nil {
+		return nil, ctx.err
+	}
+	return match, err
 }
 
 // resolveResponse resolves a response configuration to an actual response
@@ -186,6 +266,12 @@ func (imp *Imposter) resolveResponse(config *ResponseConfig, request *Request, r
 	if config.Is != nil {
 		// Static response
 		response = config.Is
+		if response.BodyFile != "" {
+			var err error
+			if response, err = imp.withBodyFile(response, len(config.Behaviors) > 0); err != nil {
+				return nil, err
+			}
+		}
 	} else if config.Proxy != nil {
 		// Proxy response
 		// TODO: Implement proxy support
@@ -234,17 +320,33 @@ func (imp *Imposter) resolveResponse(config *ResponseConfig, request *Request, r
 
 // Stop stops the imposter
 func (imp *Imposter) Stop() error {
+	// Release requests still waiting on a wait behavior
+	imp.behaviorExecutor.Close()
+
 	return imp.closeFunc(func() {
 		imp.logger.Info("Imposter stopped")
 	})
 }
 
-// ResetRequests clears all recorded requests
+// Callbacks returns the callbacks sent by callback behaviors
+func (imp *Imposter) Callbacks() []CallbackRecord {
+	return imp.behaviorExecutor.Callbacks()
+}
+
+// ResetCallbacks clears the recorded callbacks
+func (imp *Imposter) ResetCallbacks() {
+	imp.behaviorExecutor.ResetCallbacks()
+}
+
+// ResetRequests clears all recorded requests, along with the callbacks
+// they caused
 func (imp *Imposter) ResetRequests() error {
 	imp.mu.Lock()
 	imp.numberOfRequests = 0
 	imp.mu.Unlock()
 
+	imp.behaviorExecutor.ResetCallbacks()
+
 	return imp.stubs.DeleteSavedRequests()
 }
 
@@ -268,9 +370,15 @@ func (imp *Imposter) ToJSON(options map[string]interface{}) *ImposterInfo {
 		AllowCORS:       imp.allowCORS,
 		Key:             imp.key,
 		Cert:            imp.cert,
+		CA:              imp.ca,
 		MutualAuth:      imp.mutualAuth,
 		Mode:            imp.mode,
 		Host:            imp.host,
+
+		CompressResponses: imp.compressResponses,
+		ForwardProxy:      imp.forwardProxy,
+		TLS:               imp.tls,
+		InjectionTimeout:  imp.injectionTimeout,
 	}
 
 	// Helper to check options
@@ -306,7 +414,7 @@ func (imp *Imposter) ToJSON(options map[string]interface{}) *ImposterInfo {
 		// We use a pointer to the slice
 		filteredStubs := make([]Stub, 0, len(allStubs))
 
-		for i, stub := range allStubs {
+		for _, stub := range allStubs {
 			if removeProxies && stub.IsProxy {
 				continue
 			}
@@ -318,20 +426,34 @@ func (imp *Imposter) ToJSON(options map[string]interface{}) *ImposterInfo {
 				stubCopy.Links = nil
 				filteredStubs = append(filteredStubs, stubCopy)
 			} else {
-				// Add hypermedia links to stub
-				stubCopy := stub
-				stubCopy.Links = &StubLinks{
-					Self: &Link{
-						Href: fmt.Sprintf("/imposters/%d/stubs/%d", imp.port, i),
-					},
-				}
-				filteredStubs = append(filteredStubs, stubCopy)
+				filteredStubs = append(filteredStubs, imp.StubWithLinks(stub))
 			}
 		}
 		info.Stubs = &filteredStubs
 	}
 	// If !includeStubs, info.Stubs remains nil -> omitted
 
+	for _, vh := range imp.virtualHosts {
+		virtualHost := VirtualHost{
+			Host:            vh.host,
+			DefaultResponse: vh.defaultResponse,
+			Key:             vh.key,
+			Cert:            vh.cert,
+		}
+		if includeStubs {
+			for _, stub := range vh.stubs.GetAll() {
+				if removeProxies && stub.IsProxy {
+					continue
+				}
+				if replayable {
+					stub.Matches = nil
+				}
+				virtualHost.Stubs = append(virtualHost.Stubs, stub)
+			}
+		}
+		info.VirtualHosts = append(info.VirtualHosts, virtualHost)
+	}
+
 	// Include requests if requested
 	// If replayable is true, requests should be removed regardless of requests option
 	if !replayable && (options == nil || options["requests"] == true) {
@@ -378,6 +500,17 @@ func (imp *Imposter) ToJSON(options map[string]interface{}) *ImposterInfo {
 	return info
 }
 
+// StubWithLinks adds hypermedia links to a stub. Links use the stub id so
+// they stay valid as other stubs come and go.
+func (imp *Imposter) StubWithLinks(stub Stub) Stub {
+	stub.Links = &StubLinks{
+		Self: &Link{
+			Href: fmt.Sprintf("/imposters/%d/stubs/%s", imp.port, url.PathEscape(stub.ID)),
+		},
+	}
+	return stub
+}
+
 // Port returns the imposter's port
 func (imp *Imposter) Port() int {
 	return imp.port
@@ -392,20 +525,3 @@ func (imp *Imposter) Protocol() string {
 func (imp *Imposter) Stubs() *StubRepository {
 	return imp.stubs
 }
-
-// executeMiddleware executes global middleware
-func (imp *Imposter) executeMiddleware(request *Request) (*Response, error) {
-	/*
-			if imp.middleware == "" {
-				return nil, nil
-			}
-
-			if !imp.allowInjection {
-				return nil, fmt.Errorf("invalid injection: JavaScript injection is not allowed unless mb is run with the --allowInjection flag")
-			}
-
-			vm := goja.New()
-		    // ...
-	*/
-	return nil, nil
-}
@@ -2,18 +2,16 @@ package models
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
 	"github.com/dop251/goja"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
 )
 
 // evaluateInject executes the injection function
 func (imp *Imposter) evaluateInject(injectFunction string, request *Request, requestDetails map[string]interface{}) (*Response, error) {
-	vm := goja.New()
-
-	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
-
 	// Set request
 	// We need to handle the case where Body is an object (map[string]interface{})
 	// but the injection script expects a string (to call JSON.parse).
@@ -44,117 +42,6 @@ func (imp *Imposter) evaluateInject(injectFunction string, request *Request, req
 	// Add 'Body' alias to support scripts using request.Body (deprecated but used in templates)
 	reqMap["Body"] = reqMap["body"]
 
-	vm.Set("request", reqMap)
-
-	// Set logger
-	logObj := vm.NewObject()
-	logObj.Set("debug", func(msg string) { imp.logger.Debug(msg) })
-	logObj.Set("info", func(msg string) { imp.logger.Info(msg) })
-	logObj.Set("warn", func(msg string) { imp.logger.Warn(msg) })
-	logObj.Set("error", func(msg string) { imp.logger.Error(msg) })
-	vm.Set("logger", logObj)
-
-	// Polyfill console to map to logger
-	consoleObj := vm.NewObject()
-	logFn := func(call goja.FunctionCall) goja.Value {
-		var args []interface{}
-		for _, arg := range call.Arguments {
-			args = append(args, arg.Export())
-		}
-		imp.logger.Info(fmt.Sprint(args...))
-		return goja.Undefined()
-	}
-	warnFn := func(call goja.FunctionCall) goja.Value {
-		var args []interface{}
-		for _, arg := range call.Arguments {
-			args = append(args, arg.Export())
-		}
-		imp.logger.Warn(fmt.Sprint(args...))
-		return goja.Undefined()
-	}
-	errorFn := func(call goja.FunctionCall) goja.Value {
-		var args []interface{}
-		for _, arg := range call.Arguments {
-			args = append(args, arg.Export())
-		}
-		imp.logger.Error(fmt.Sprint(args...))
-		return goja.Undefined()
-	}
-
-	consoleObj.Set("log", logFn)
-	consoleObj.Set("info", logFn)
-	consoleObj.Set("warn", warnFn)
-	consoleObj.Set("error", errorFn)
-	// Polyfill Buffer
-	bufferObj := vm.NewObject()
-
-	// Buffer.from(string, encoding)
-	bufferObj.Set("from", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) == 0 {
-			return goja.Null()
-		}
-
-		input := call.Arguments[0].String()
-		encoding := "utf8"
-		if len(call.Arguments) > 1 {
-			encoding = call.Arguments[1].String()
-		}
-
-		var data []byte
-		if encoding == "base64" {
-			// Ignore error for now, similar to how Node might handle invalid input leniently or throw
-			// But for injection, panic might catch it.
-			d, _ := base64.StdEncoding.DecodeString(input)
-			data = d
-		} else {
-			data = []byte(input)
-		}
-
-		// Create a buffer instance object
-		bufInstance := vm.NewObject()
-		bufInstance.Set("toString", func(call goja.FunctionCall) goja.Value {
-			outEncoding := "utf8"
-			if len(call.Arguments) > 0 {
-				outEncoding = call.Arguments[0].String()
-			}
-
-			if outEncoding == "base64" {
-				return vm.ToValue(base64.StdEncoding.EncodeToString(data))
-			}
-			return vm.ToValue(string(data))
-		})
-
-		return bufInstance
-	})
-
-	// Buffer.alloc(size)
-	bufferObj.Set("alloc", func(call goja.FunctionCall) goja.Value {
-		size := 0
-		if len(call.Arguments) > 0 {
-			size = int(call.Arguments[0].ToInteger())
-		}
-		data := make([]byte, size)
-
-		bufInstance := vm.NewObject()
-		bufInstance.Set("toString", func(call goja.FunctionCall) goja.Value {
-			outEncoding := "utf8"
-			if len(call.Arguments) > 0 {
-				outEncoding = call.Arguments[0].String()
-			}
-
-			if outEncoding == "base64" {
-				return vm.ToValue(base64.StdEncoding.EncodeToString(data))
-			}
-			return vm.ToValue(string(data))
-		})
-
-		return bufInstance
-	})
-
-	vm.Set("Buffer", bufferObj)
-
-	vm.Set("console", consoleObj)
-
 	// Wrap in a function call
 	// Create JS-compatible logger map
 	jsLogger := map[string]interface{}{
@@ -167,14 +54,28 @@ func (imp *Imposter) evaluateInject(injectFunction string, request *Request, req
 	// Prepare config object
 	config := map[string]interface{}{
 		"request": reqMap,
-		"state":   imp.state,
 		"logger":  jsLogger,
 	}
 
-	vm.Set("config", config)
-	vm.Set("request", reqMap)
-	vm.Set("state", imp.state)
-	vm.Set("logger", logObj) // Keep global logger for backward compatibility if needed
+	// State is locked as the script first touches it, until the script ends
+	session := imp.state.session()
+	defer session.close()
+
+	// Globals needing the runtime are created once it is borrowed
+	setup := func(vm *goja.Runtime) map[string]interface{} {
+		state, globalState := session.objects(vm)
+		config["state"], config["globalState"] = state, globalState
+		return map[string]interface{}{
+			"config":      config,
+			"request":     reqMap,
+			"state":       state,
+			"globalState": globalState,
+			"logger":      imp.injectLogger(vm), // Keep global logger for backward compatibility if needed
+			"console":     imp.injectConsole(vm),
+			"Buffer":      newBufferObject(vm),
+			"faker":       newFakerObject(vm, defaultFaker),
+		}
+	}
 
 	// Wrap in a function call
 	// We pass 'config' as the first argument to support the standard signature function(config)
@@ -197,11 +98,14 @@ func (imp *Imposter) evaluateInject(injectFunction string, request *Request, req
 			if (typeof fn !== 'function') {
 				throw new Error("Injection must evaluate to a function");
 			}
+
+			// Async injections hand their response to callback
+			config.callback = callback;
 			
 			// Check arity
-			if (fn.length === 3) {
-				// Legacy: function(request, state, logger)
-				return fn(request, state, logger);
+			if (fn.length === 3 || fn.length === 4) {
+				// Legacy: function(request, state, logger, callback)
+				return fn(request, state, logger, callback);
 			} else {
 				// Check if the function specifically requests 'request' as the first argument
 				// This handles legacy inline scripts like function(request) { ... }
@@ -212,7 +116,7 @@ func (imp *Imposter) evaluateInject(injectFunction string, request *Request, req
 				if (isLegacyRequest) {
 					// Legacy: function(request, state, logger)
 					// Even if arity is 1, if it's named request, pass request.
-					return fn(request, state, logger);
+					return fn(request, state, logger, callback);
 				} else {
 					// Standard: function(config)
 					return fn(config);
@@ -221,22 +125,17 @@ func (imp *Imposter) evaluateInject(injectFunction string, request *Request, req
 		})()
 	`, injectFunction)
 
-	// Execute with lock to protect state
-	imp.mu.Lock()
-	defer imp.mu.Unlock()
-
-	// Bind state
-	vm.Set("state", imp.state)
-
-	val, err := vm.RunString(script)
+	var export interface{}
+	err := imp.scripts.Run(script, session, setup, func(vm *goja.Runtime, val goja.Value) error {
+		// Parse response
+		// Expecting object with statusCode, headers, body
+		export = val.Export()
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("injection execution failed: %w", err)
 	}
 
-	// Parse response
-	// Expecting object with statusCode, headers, body
-	export := val.Export()
-
 	// Convert export to Response
 	// Easiest is via JSON roundtrip for type safety
 	jsonBytes, err := json.Marshal(export)
@@ -251,3 +150,193 @@ func (imp *Imposter) evaluateInject(injectFunction string, request *Request, req
 
 	return &response, nil
 }
+
+// executeMiddleware runs the imposter's middleware before stubs are
+// matched. The script sees the same globals as response injection and may
+// change config.request, which is then matched in place of the original, or
+// return a response to send without matching stubs.
+func (imp *Imposter) executeMiddleware(request *Request) (*Request, *Response, error) {
+	if imp.middleware == "" {
+		return request, nil, nil
+	}
+	if !imp.allowInjection {
+		return nil, nil, fmt.Errorf("invalid injection: JavaScript injection is not allowed unless mb is run with the --allowInjection flag")
+	}
+
+	reqMap := make(map[string]interface{})
+	tmpBytes, _ := json.Marshal(request)
+	json.Unmarshal(tmpBytes, &reqMap)
+
+	config := map[string]interface{}{"request": reqMap}
+
+	// State is locked as the script first touches it, until the script ends
+	session := imp.state.session()
+	defer session.close()
+
+	setup := func(vm *goja.Runtime) map[string]interface{} {
+		state, globalState := session.objects(vm)
+		config["state"], config["globalState"] = state, globalState
+		config["logger"] = imp.injectLogger(vm)
+		return map[string]interface{}{
+			"config":  config,
+			"console": imp.injectConsole(vm),
+			"Buffer":  newBufferObject(vm),
+		}
+	}
+
+	script := fmt.Sprintf("(config.callback = callback, %s)(config)", imp.middleware)
+
+	var result, changed interface{}
+	err := imp.scripts.Run(script, session, setup, func(vm *goja.Runtime, val goja.Value) error {
+		if !util.IsUndefined(val) && !goja.IsNull(val) {
+			result = val.Export()
+		}
+		changed = vm.ToValue(config["request"]).Export()
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("middleware execution failed: %w", err)
+	}
+
+	if result != nil {
+		jsonBytes, err := json.Marshal(result)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal middleware result: %w", err)
+		}
+		var response Response
+		if err := json.Unmarshal(jsonBytes, &response); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal middleware result to Response: %w", err)
+		}
+		return request, &response, nil
+	}
+
+	// The recorded request keeps its original values
+	jsonBytes, err := json.Marshal(changed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal middleware request: %w", err)
+	}
+	var modified Request
+	if err := json.Unmarshal(jsonBytes, &modified); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal middleware request: %w", err)
+	}
+	rewritten := *request
+	rewritten.Method, rewritten.Path = modified.Method, modified.Path
+	rewritten.Query, rewritten.Headers, rewritten.Body = modified.Query, modified.Headers, modified.Body
+	return &rewritten, nil, nil
+}
+
+// injectLogger creates the global logger object for response injection
+func (imp *Imposter) injectLogger(vm *goja.Runtime) *goja.Object {
+	logObj := vm.NewObject()
+	logObj.Set("debug", func(msg string) { imp.logger.Debug(msg) })
+	logObj.Set("info", func(msg string) { imp.logger.Info(msg) })
+	logObj.Set("warn", func(msg string) { imp.logger.Warn(msg) })
+	logObj.Set("error", func(msg string) { imp.logger.Error(msg) })
+	return logObj
+}
+
+// injectConsole creates a console object mapped to the imposter logger
+func (imp *Imposter) injectConsole(vm *goja.Runtime) *goja.Object {
+	consoleObj := vm.NewObject()
+	logFn := func(call goja.FunctionCall) goja.Value {
+		var args []interface{}
+		for _, arg := range call.Arguments {
+			args = append(args, arg.Export())
+		}
+		imp.logger.Info(fmt.Sprint(args...))
+		return goja.Undefined()
+	}
+	warnFn := func(call goja.FunctionCall) goja.Value {
+		var args []interface{}
+		for _, arg := range call.Arguments {
+			args = append(args, arg.Export())
+		}
+		imp.logger.Warn(fmt.Sprint(args...))
+		return goja.Undefined()
+	}
+	errorFn := func(call goja.FunctionCall) goja.Value {
+		var args []interface{}
+		for _, arg := range call.Arguments {
+			args = append(args, arg.Export())
+		}
+		imp.logger.Error(fmt.Sprint(args...))
+		return goja.Undefined()
+	}
+
+	consoleObj.Set("log", logFn)
+	consoleObj.Set("info", logFn)
+	consoleObj.Set("warn", warnFn)
+	consoleObj.Set("error", errorFn)
+	return consoleObj
+}
+
+// newBufferObject polyfills the parts of Node's Buffer scripts commonly use
+func newBufferObject(vm *goja.Runtime) *goja.Object {
+	bufferObj := vm.NewObject()
+
+	// Buffer.from(string, encoding)
+	bufferObj.Set("from", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) == 0 {
+			return goja.Null()
+		}
+
+		input := call.Arguments[0].String()
+		encoding := "utf8"
+		if len(call.Arguments) > 1 {
+			encoding = call.Arguments[1].String()
+		}
+
+		var data []byte
+		switch encoding {
+		case "base64":
+			// Ignore error for now, similar to how Node might handle invalid input leniently or throw
+			// But for injection, panic might catch it.
+			d, _ := base64.StdEncoding.DecodeString(input)
+			data = d
+		case "hex":
+			d, _ := hex.DecodeString(input)
+			data = d
+		default:
+			data = []byte(input)
+		}
+
+		return newBufferInstance(vm, data)
+	})
+
+	// Buffer.alloc(size)
+	bufferObj.Set("alloc", func(call goja.FunctionCall) goja.Value {
+		size := 0
+		if len(call.Arguments) > 0 {
+			size = int(call.Arguments[0].ToInteger())
+		}
+		return newBufferInstance(vm, make([]byte, size))
+	})
+
+	return bufferObj
+}
+
+// newBufferInstance creates a buffer object holding data
+func newBufferInstance(vm *goja.Runtime, data []byte) *goja.Object {
+	bufInstance := vm.NewObject()
+	bufInstance.Set("length", len(data))
+	bufInstance.Set("toString", func(call goja.FunctionCall) goja.Value {
+		outEncoding := "utf8"
+		if len(call.Arguments) > 0 {
+			outEncoding = call.Arguments[0].String()
+		}
+
+		return vm.ToValue(encodeBytes(data, outEncoding))
+	})
+	return bufInstance
+}
+
+// encodeBytes renders data as base64, hex or utf8 text
+func encodeBytes(data []byte, encoding string) string {
+	switch encoding {
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data)
+	case "hex":
+		return hex.EncodeToString(data)
+	}
+	return string(data)
+}
@@ -3,48 +3,71 @@ package models
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 
-	"github.com/antchfx/xmlquery"
 	"github.com/dop251/goja"
 	"github.com/mountebank-testing/mountebank-go/internal/util"
-	"github.com/oliveagle/jsonpath"
 )
 
 // PredicateEvaluator evaluates predicates against requests
 type PredicateEvaluator struct {
 	encoding       string
 	logger         *util.Logger
-	state          map[string]interface{}
+	state          ScriptState
 	allowInjection bool
+	scripts        *ScriptEngine
 }
 
 // NewPredicateEvaluator creates a new predicate evaluator
-func NewPredicateEvaluator(encoding string, logger *util.Logger, state map[string]interface{}, allowInjection bool) *PredicateEvaluator {
+func NewPredicateEvaluator(encoding string, logger *util.Logger, state ScriptState, allowInjection bool, scripts *ScriptEngine) *PredicateEvaluator {
 	return &PredicateEvaluator{
 		encoding:       encoding,
 		logger:         logger,
 		state:          state,
 		allowInjection: allowInjection,
+		scripts:        scripts,
 	}
 }
 
-// Evaluate evaluates a predicate against a request
-func (pe *PredicateEvaluator) Evaluate(predicate Predicate, request *Request) bool {
+// Evaluate reports whether all of a stub's predicates match a request,
+// using the predicates compiled when the stub was added
+func (pe *PredicateEvaluator) Evaluate(stub *Stub, request *Request) bool {
+	return pe.matchStub(stub, pe.newMatchContext(request))
+}
+
+// matchStub evaluates the compiled predicates of a stub. Stubs whose
+// predicates have not been compiled never match, and neither does any stub
+// once a predicate script has run away.
+func (pe *PredicateEvaluator) matchStub(stub *Stub, ctx *matchContext) bool {
+	if len(stub.matchers) != len(stub.Predicates) || ctx.err != nil {
+		return false
+	}
+	for _, m := range stub.matchers {
+		if !pe.match(m, ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// match evaluates a compiled predicate against a request
+func (pe *PredicateEvaluator) match(m *predicateMatcher, ctx *matchContext) bool {
+	predicate := m.predicate
 	hasOperators := false
 
 	// Check which predicate type is being used
 	if predicate.Equals != nil {
 		hasOperators = true
-		if pe.evaluateEquals(predicate, request) {
+		if pe.evaluateEquals(m, ctx) {
 			return true
 		}
 	}
 	if predicate.DeepEquals != nil {
 		hasOperators = true
-		if pe.evaluateDeepEquals(predicate, request) {
+		if pe.evaluateDeepEquals(m, ctx) {
 			return true
 		}
 	}
@@ -54,45 +77,45 @@ func (pe *PredicateEvaluator) Evaluate(predicate Predicate, request *Request) bo
 
 	if predicate.Contains != nil {
 		hasOperators = true
-		if pe.evaluateContains(predicate, request) {
+		if pe.evaluateContains(m, ctx) {
 			return true
 		}
 	}
 	if predicate.StartsWith != nil {
 		hasOperators = true
-		if pe.evaluateStartsWith(predicate, request) {
+		if pe.evaluateStartsWith(m, ctx) {
 			return true
 		}
 	}
 	if predicate.EndsWith != nil {
 		hasOperators = true
-		if pe.evaluateEndsWith(predicate, request) {
+		if pe.evaluateEndsWith(m, ctx) {
 			return true
 		}
 	}
 	if predicate.Matches != nil {
 		hasOperators = true
-		if pe.evaluateMatches(predicate, request) {
+		if pe.evaluateMatches(m, ctx) {
 			return true
 		}
 	}
 	if predicate.Exists != nil {
 		hasOperators = true
-		if pe.evaluateExists(predicate, request) {
+		if pe.evaluateExists(m, ctx) {
 			return true
 		}
 	}
 	if predicate.Not != nil {
 		hasOperators = true
 		// Implicit OR: matches(A) || not(matches(B))
-		if !pe.Evaluate(*predicate.Not, request) {
+		if !pe.match(m.not, ctx) {
 			return true
 		}
 	}
 	if predicate.Or != nil {
 		hasOperators = true
-		for _, p := range predicate.Or {
-			if pe.Evaluate(p, request) {
+		for _, p := range m.or {
+			if pe.match(p, ctx) {
 				return true
 			}
 		}
@@ -121,8 +144,8 @@ func (pe *PredicateEvaluator) Evaluate(predicate Predicate, request *Request) bo
 	if predicate.And != nil {
 		hasOperators = true
 		matchesAnd := true
-		for _, p := range predicate.And {
-			if !pe.Evaluate(p, request) {
+		for _, p := range m.and {
+			if !pe.match(p, ctx) {
 				matchesAnd = false
 				break
 			}
@@ -133,7 +156,7 @@ func (pe *PredicateEvaluator) Evaluate(predicate Predicate, request *Request) bo
 	}
 	if predicate.Inject != "" {
 		hasOperators = true
-		if pe.evaluateInject(predicate, request) {
+		if pe.evaluateInject(predicate, ctx) {
 			return true
 		}
 	}
@@ -148,20 +171,20 @@ func (pe *PredicateEvaluator) Evaluate(predicate Predicate, request *Request) bo
 }
 
 // evaluateEquals checks if request fields equal expected values
-func (pe *PredicateEvaluator) evaluateEquals(predicate Predicate, request *Request) bool {
-	expected := pe.normalize(predicate.Equals, predicate, false)
-	actual := pe.normalize(pe.requestToMap(request), predicate, true)
+func (pe *PredicateEvaluator) evaluateEquals(m *predicateMatcher, ctx *matchContext) bool {
+	expected := m.equals
+	actual := pe.actual(m, ctx)
 
-	return pe.predicateSatisfied(expected, actual, predicate, func(a, b interface{}) bool {
+	return pe.predicateSatisfied(expected, actual, m.predicate, func(a, b interface{}) bool {
 		return fmt.Sprint(a) == fmt.Sprint(b)
 	})
 }
 
 // evaluateDeepEquals checks deep equality
 // evaluateDeepEquals checks deep equality
-func (pe *PredicateEvaluator) evaluateDeepEquals(predicate Predicate, request *Request) bool {
-	expected := pe.normalize(predicate.DeepEquals, predicate, false)
-	actual := pe.normalize(pe.requestToMap(request), predicate, true)
+func (pe *PredicateEvaluator) evaluateDeepEquals(m *predicateMatcher, ctx *matchContext) bool {
+	expected := m.deepEquals
+	actual := pe.actual(m, ctx)
 
 	// The root request object usually contains more fields than the predicate (e.g. method, headers).
 	// But deepEquals expects the fields THAT ARE PROVIDED to match exactly.
@@ -202,11 +225,11 @@ func (pe *PredicateEvaluator) evaluateDeepEquals(predicate Predicate, request *R
 }
 
 // evaluateContains checks if actual contains expected
-func (pe *PredicateEvaluator) evaluateContains(predicate Predicate, request *Request) bool {
-	expected := pe.normalize(predicate.Contains, predicate, false)
-	actual := pe.normalize(pe.requestToMap(request), predicate, true)
+func (pe *PredicateEvaluator) evaluateContains(m *predicateMatcher, ctx *matchContext) bool {
+	expected := m.contains
+	actual := pe.actual(m, ctx)
 
-	return pe.predicateSatisfied(expected, actual, predicate, func(a, b interface{}) bool {
+	return pe.predicateSatisfied(expected, actual, m.predicate, func(a, b interface{}) bool {
 		aStr := fmt.Sprint(a)
 		bStr := fmt.Sprint(b)
 		return strings.Contains(bStr, aStr)
@@ -214,11 +237,11 @@ func (pe *PredicateEvaluator) evaluateContains(predicate Predicate, request *Req
 }
 
 // evaluateStartsWith checks if actual starts with expected
-func (pe *PredicateEvaluator) evaluateStartsWith(predicate Predicate, request *Request) bool {
-	expected := pe.normalize(predicate.StartsWith, predicate, false)
-	actual := pe.normalize(pe.requestToMap(request), predicate, true)
+func (pe *PredicateEvaluator) evaluateStartsWith(m *predicateMatcher, ctx *matchContext) bool {
+	expected := m.startsWith
+	actual := pe.actual(m, ctx)
 
-	return pe.predicateSatisfied(expected, actual, predicate, func(a, b interface{}) bool {
+	return pe.predicateSatisfied(expected, actual, m.predicate, func(a, b interface{}) bool {
 		aStr := fmt.Sprint(a)
 		bStr := fmt.Sprint(b)
 		return strings.HasPrefix(bStr, aStr)
@@ -226,11 +249,11 @@ func (pe *PredicateEvaluator) evaluateStartsWith(predicate Predicate, request *R
 }
 
 // evaluateEndsWith checks if actual ends with expected
-func (pe *PredicateEvaluator) evaluateEndsWith(predicate Predicate, request *Request) bool {
-	expected := pe.normalize(predicate.EndsWith, predicate, false)
-	actual := pe.normalize(pe.requestToMap(request), predicate, true)
+func (pe *PredicateEvaluator) evaluateEndsWith(m *predicateMatcher, ctx *matchContext) bool {
+	expected := m.endsWith
+	actual := pe.actual(m, ctx)
 
-	return pe.predicateSatisfied(expected, actual, predicate, func(a, b interface{}) bool {
+	return pe.predicateSatisfied(expected, actual, m.predicate, func(a, b interface{}) bool {
 		aStr := fmt.Sprint(a)
 		bStr := fmt.Sprint(b)
 		return strings.HasSuffix(bStr, aStr)
@@ -238,41 +261,23 @@ func (pe *PredicateEvaluator) evaluateEndsWith(predicate Predicate, request *Req
 }
 
 // evaluateMatches checks if actual matches regex pattern
-func (pe *PredicateEvaluator) evaluateMatches(predicate Predicate, request *Request) bool {
-	if pe.encoding == "base64" {
-		pe.logger.Error("the matches predicate is not allowed in binary mode")
-		return false
-	}
-
-	expected := pe.normalize(predicate.Matches, predicate, false)
-	actual := pe.normalize(pe.requestToMap(request), predicate, true)
-
-	caseSensitive := predicate.CaseSensitive != nil && *predicate.CaseSensitive
-
-	return pe.predicateSatisfied(expected, actual, predicate, func(a, b interface{}) bool {
-		pattern := fmt.Sprint(a)
-		text := fmt.Sprint(b)
-
-		if !caseSensitive {
-			pattern = "(?i)" + pattern
-		}
-
-		matched, err := regexp.MatchString(pattern, text)
-		if err != nil {
-			pe.logger.Warnf("Invalid regex pattern: %s", pattern)
-			return false
-		}
-
-		return matched
+func (pe *PredicateEvaluator) evaluateMatches(m *predicateMatcher, ctx *matchContext) bool {
+	expected := m.matches
+	actual := pe.actual(m, ctx)
+
+	// Patterns were compiled, and made case-insensitive, with the predicate
+	return pe.predicateSatisfied(expected, actual, m.predicate, func(a, b interface{}) bool {
+		pattern, ok := a.(*regexp.Regexp)
+		return ok && pattern.MatchString(fmt.Sprint(b))
 	})
 }
 
 // evaluateExists checks if a field exists
-func (pe *PredicateEvaluator) evaluateExists(predicate Predicate, request *Request) bool {
-	expected := pe.normalize(predicate.Exists, predicate, false)
-	actual := pe.normalize(pe.requestToMap(request), predicate, true)
+func (pe *PredicateEvaluator) evaluateExists(m *predicateMatcher, ctx *matchContext) bool {
+	expected := m.exists
+	actual := pe.actual(m, ctx)
 
-	return pe.predicateSatisfied(expected, actual, predicate, func(a, b interface{}) bool {
+	return pe.predicateSatisfied(expected, actual, m.predicate, func(a, b interface{}) bool {
 		shouldExist, ok := a.(bool)
 		if !ok {
 			return false
@@ -283,8 +288,10 @@ func (pe *PredicateEvaluator) evaluateExists(predicate Predicate, request *Reque
 	})
 }
 
-// evaluateInject evaluates injected JavaScript predicate
-func (pe *PredicateEvaluator) evaluateInject(predicate Predicate, request *Request) bool {
+// evaluateInject evaluates injected JavaScript predicate. A script stopped
+// by the timeout or the call stack limit is recorded on the context.
+func (pe *PredicateEvaluator) evaluateInject(predicate Predicate, ctx *matchContext) bool {
+	request := ctx.request
 	if request.IsDryRun {
 		return true
 	}
@@ -294,8 +301,6 @@ func (pe *PredicateEvaluator) evaluateInject(predicate Predicate, request *Reque
 		return false
 	}
 
-	vm := goja.New()
-
 	// Create JS-compatible logger
 	jsLogger := map[string]interface{}{
 		"debug": func(msg string, args ...interface{}) { pe.logger.Debugf(msg, args...) },
@@ -307,13 +312,9 @@ func (pe *PredicateEvaluator) evaluateInject(predicate Predicate, request *Reque
 	// Create config object
 	config := map[string]interface{}{
 		"request": pe.requestToMap(request),
-		"state":   pe.state,
 		"logger":  jsLogger,
 	}
 
-	vm.Set("config", config)
-	vm.Set("logger", jsLogger)
-
 	// The injection code is expected to be a function expression
 	// We wrap it in parentheses and call it with (config, logger)
 	// The injection code is expected to be a function expression
@@ -324,6 +325,9 @@ func (pe *PredicateEvaluator) evaluateInject(predicate Predicate, request *Reque
 			if (typeof fn !== 'function') {
 				throw new Error("Injection must evaluate to a function");
 			}
+
+			// Async predicates hand their result to callback
+			config.callback = callback;
 			
 			if (fn.length === 2) {
 				// Legacy: function(request, logger)
@@ -358,23 +362,37 @@ func (pe *PredicateEvaluator) evaluateInject(predicate Predicate, request *Reque
 				return fn(config.request, logger);
 			}
 			
-			// Default to passing config (and logger as extra which is harmless for arity 1)
-			return fn(config, logger);
+			// Default to passing config (and logger and callback as extras which are harmless for arity 1)
+			return fn(config, logger, callback);
 		})()
 	`, predicate.Inject)
 
-	val, err := vm.RunString(script)
+	var result interface{}
+	session := pe.state.session()
+	defer session.close()
+
+	err := pe.scripts.Run(script, session, func(vm *goja.Runtime) map[string]interface{} {
+		config["state"], config["globalState"] = session.objects(vm)
+		return map[string]interface{}{"config": config, "logger": jsLogger}
+	}, func(vm *goja.Runtime, val goja.Value) error {
+		result = val.Export()
+		return nil
+	})
+	if errors.Is(err, ErrScriptTimeout) || errors.Is(err, ErrScriptStackOverflow) {
+		ctx.err = fmt.Errorf("injection execution failed: %w", err)
+		return false
+	}
 	if err != nil {
 		pe.logger.Errorf("Injection error: %v", err)
 		return false
 	}
 
-	if boolVal, ok := val.Export().(bool); ok {
+	if boolVal, ok := result.(bool); ok {
 		pe.logger.Infof("Injection result: %v", boolVal)
 		return boolVal
 	}
 
-	pe.logger.Warnf("Injection returned non-boolean: %v", val.Export())
+	pe.logger.Warnf("Injection returned non-boolean: %v", result)
 	return false
 }
 
@@ -390,7 +408,7 @@ func (pe *PredicateEvaluator) predicateSatisfied(expected, actual interface{}, p
 		if actualStr, ok := actual.(string); ok {
 			var parsedMap map[string]interface{}
 			if err := json.Unmarshal([]byte(actualStr), &parsedMap); err == nil {
-				actual = pe.normalize(parsedMap, predicate, true)
+				actual = pe.normalize(parsedMap, predicate)
 			}
 		}
 
@@ -455,18 +473,22 @@ func (pe *PredicateEvaluator) predicateSatisfied(expected, actual interface{}, p
 		return false
 	}
 
+	// Repeated fields (headers, query parameters) match if any value does
+	if actualArr, ok := actual.([]interface{}); ok {
+		for _, actVal := range actualArr {
+			if pe.predicateSatisfied(expected, actVal, predicate, fn) {
+				return true
+			}
+		}
+		return false
+	}
+
 	// Direct comparison
 	return fn(expected, actual)
 }
 
 // normalize normalizes a value for comparison
-func (pe *PredicateEvaluator) normalize(value interface{}, predicate Predicate, withSelectors bool) interface{} {
-	// Apply selectors if requested
-	if withSelectors {
-		value = pe.selectValue(value, predicate)
-	}
-
-	// If value is nil after selection, return nil
+func (pe *PredicateEvaluator) normalize(value interface{}, predicate Predicate) interface{} {
 	if value == nil {
 		return nil
 	}
@@ -482,6 +504,17 @@ func (pe *PredicateEvaluator) normalize(value interface{}, predicate Predicate,
 				normalizedKey = strings.ToLower(key)
 			}
 			result[normalizedKey] = pe.normalizeValue(val, predicate, caseSensitive)
+
+			// Header names are case-insensitive even when values are not
+			if caseSensitive && key == "headers" {
+				if headers, ok := result[key].(map[string]interface{}); ok {
+					lowered := make(map[string]interface{}, len(headers))
+					for name, headerValue := range headers {
+						lowered[strings.ToLower(name)] = headerValue
+					}
+					result[key] = lowered
+				}
+			}
 		}
 		return result
 	}
@@ -491,59 +524,6 @@ func (pe *PredicateEvaluator) normalize(value interface{}, predicate Predicate,
 	return pe.normalizeValue(value, predicate, caseSensitive)
 }
 
-// selectValue applies selectors (JSONPath, XPath) to the value
-func (pe *PredicateEvaluator) selectValue(value interface{}, predicate Predicate) interface{} {
-	if predicate.JSONPath != nil {
-		res, err := jsonpath.JsonPathLookup(value, predicate.JSONPath.Selector)
-		if err != nil {
-			pe.logger.Debugf("JSONPath lookup failed: %v", err)
-			return nil
-		}
-		return res
-	}
-
-	if predicate.XPath != nil {
-		var xmlBody string
-		if m, ok := value.(map[string]interface{}); ok {
-			if b, ok := m["body"].(string); ok {
-				xmlBody = b
-			}
-		} else if s, ok := value.(string); ok {
-			xmlBody = s
-		}
-
-		if xmlBody == "" {
-			return nil
-		}
-
-		doc, err := xmlquery.Parse(strings.NewReader(xmlBody))
-		if err != nil {
-			pe.logger.Debugf("XML parse failed: %v", err)
-			return nil
-		}
-
-		// Handle namespaces if provided
-		if len(predicate.XPath.NS) > 0 {
-			// xmlquery doesn't support dynamic namespaces easily in FindOne?
-			// It seems xmlquery supports namespaces in the selector directly or via a map?
-			// Looking at xmlquery docs/examples...
-			// It seems we might need to use a different function or just pass the selector.
-			// But for now let's assume standard XPath selector.
-			// Mountebank passes 'ns' map.
-			// xmlquery doesn't seem to have a direct way to pass a namespace map to FindOne.
-			// But we can ignore namespaces for now or assume they are in the selector.
-		}
-
-		node := xmlquery.FindOne(doc, predicate.XPath.Selector)
-		if node != nil {
-			return node.InnerText()
-		}
-		return nil
-	}
-
-	return value
-}
-
 // normalizeValue normalizes a single value
 func (pe *PredicateEvaluator) normalizeValue(value interface{}, predicate Predicate, caseSensitive bool) interface{} {
 	// Handle encoding transformation
@@ -573,7 +553,7 @@ func (pe *PredicateEvaluator) normalizeValue(value interface{}, predicate Predic
 
 	// Handle nested objects
 	if objMap, ok := value.(map[string]interface{}); ok {
-		return pe.normalize(objMap, predicate, caseSensitive)
+		return pe.normalize(objMap, predicate)
 	}
 
 	// Handle arrays
@@ -604,6 +584,12 @@ func (pe *PredicateEvaluator) requestToMap(request *Request) map[string]interfac
 	if request.Headers != nil {
 		result["headers"] = request.Headers
 	}
+	if request.Cookies != nil {
+		result["cookies"] = request.Cookies
+	}
+	if request.Host != "" {
+		result["host"] = request.Host
+	}
 	if request.Body != nil {
 		result["body"] = request.Body
 	}
@@ -0,0 +1,233 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+	"github.com/oliveagle/jsonpath"
+)
+
+// predicateMatcher is a predicate compiled for repeated evaluation. Expected
+// values are normalized, patterns and selectors compiled, and nested
+// predicates compiled in turn, so matching a request does none of that work.
+type predicateMatcher struct {
+	predicate     Predicate
+	caseSensitive bool
+
+	equals     interface{}
+	deepEquals interface{}
+	contains   interface{}
+	startsWith interface{}
+	endsWith   interface{}
+	exists     interface{}
+
+	// matches mirrors the expected fields with a *regexp.Regexp per value
+	matches interface{}
+
+	not *predicateMatcher
+	or  []*predicateMatcher
+	and []*predicateMatcher
+
+	jsonPath *jsonpath.Compiled
+	xpath    *xpath.Expr
+}
+
+// compilePredicates compiles the predicates of a stub for an imposter
+// encoding, rejecting invalid patterns and selectors
+func compilePredicates(predicates []Predicate, encoding string) ([]*predicateMatcher, error) {
+	matchers := make([]*predicateMatcher, len(predicates))
+	for i, predicate := range predicates {
+		m, err := compilePredicate(predicate, encoding)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = m
+	}
+	return matchers, nil
+}
+
+// compilePredicate compiles a single predicate and those nested within it
+func compilePredicate(predicate Predicate, encoding string) (*predicateMatcher, error) {
+	// Normalizing expected values only depends on the encoding
+	pe := &PredicateEvaluator{encoding: encoding}
+
+	m := &predicateMatcher{
+		predicate:     predicate,
+		caseSensitive: predicate.CaseSensitive != nil && *predicate.CaseSensitive,
+		equals:        pe.normalize(predicate.Equals, predicate),
+		deepEquals:    pe.normalize(predicate.DeepEquals, predicate),
+		contains:      pe.normalize(predicate.Contains, predicate),
+		startsWith:    pe.normalize(predicate.StartsWith, predicate),
+		endsWith:      pe.normalize(predicate.EndsWith, predicate),
+		exists:        pe.normalize(predicate.Exists, predicate),
+	}
+
+	if predicate.Matches != nil {
+		if encoding == "base64" {
+			return nil, util.NewValidationError("the matches predicate is not allowed in binary mode", predicate.Matches)
+		}
+		matches, err := compilePatterns(pe.normalize(predicate.Matches, predicate), m.caseSensitive)
+		if err != nil {
+			return nil, err
+		}
+		m.matches = matches
+	}
+
+	if predicate.JSONPath != nil {
+		compiled, err := jsonpath.Compile(predicate.JSONPath.Selector)
+		if err != nil {
+			return nil, util.NewValidationError(fmt.Sprintf("invalid jsonpath selector: %v", err), predicate.JSONPath.Selector)
+		}
+		m.jsonPath = compiled
+	}
+	if predicate.XPath != nil {
+		expr, err := xpath.Compile(predicate.XPath.Selector)
+		if err != nil {
+			return nil, util.NewValidationError(fmt.Sprintf("invalid xpath selector: %v", err), predicate.XPath.Selector)
+		}
+		m.xpath = expr
+	}
+
+	var err error
+	if predicate.Not != nil {
+		if m.not, err = compilePredicate(*predicate.Not, encoding); err != nil {
+			return nil, err
+		}
+	}
+	if m.or, err = compilePredicates(predicate.Or, encoding); err != nil {
+		return nil, err
+	}
+	if m.and, err = compilePredicates(predicate.And, encoding); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// compilePatterns compiles every value of a matches predicate to a regular
+// expression
+func compilePatterns(value interface{}, caseSensitive bool) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			compiled, err := compilePatterns(item, caseSensitive)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = compiled
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			compiled, err := compilePatterns(item, caseSensitive)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = compiled
+		}
+		return result, nil
+	}
+
+	pattern := fmt.Sprint(value)
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, util.NewValidationError(fmt.Sprintf("invalid regular expression: %v", err), fmt.Sprint(value))
+	}
+	return compiled, nil
+}
+
+// matchContext holds what is derived from a request while matching it, so
+// that stubs and predicates sharing the same view of the request reuse it
+type matchContext struct {
+	request *Request
+	fields  map[string]interface{}
+
+	// normalized caches the request fields per case sensitivity and except
+	normalized map[normalizedKey]interface{}
+
+	xmlParsed bool
+	xmlDoc    *xmlquery.Node
+
+	// err is the first predicate script stopped for running away, which
+	// fails the request instead of matching further stubs
+	err error
+}
+
+type normalizedKey struct {
+	caseSensitive bool
+	except        string
+}
+
+// newMatchContext prepares a request for matching
+func (pe *PredicateEvaluator) newMatchContext(request *Request) *matchContext {
+	return &matchContext{
+		request:    request,
+		fields:     pe.requestToMap(request),
+		normalized: make(map[normalizedKey]interface{}),
+	}
+}
+
+// actual returns the request value a predicate compares against: the
+// selected value when it has a selector, otherwise all request fields,
+// normalized the way the predicate asks
+func (pe *PredicateEvaluator) actual(m *predicateMatcher, ctx *matchContext) interface{} {
+	switch {
+	case m.jsonPath != nil:
+		value, err := m.jsonPath.Lookup(ctx.fields)
+		if err != nil {
+			pe.logger.Debugf("JSONPath lookup failed: %v", err)
+			return nil
+		}
+		return pe.normalize(value, m.predicate)
+
+	case m.xpath != nil:
+		doc := pe.xmlDocument(ctx)
+		if doc == nil {
+			return nil
+		}
+		node := xmlquery.QuerySelector(doc, m.xpath)
+		if node == nil {
+			return nil
+		}
+		return pe.normalize(node.InnerText(), m.predicate)
+	}
+
+	key := normalizedKey{caseSensitive: m.caseSensitive, except: m.predicate.Except}
+	if value, ok := ctx.normalized[key]; ok {
+		return value
+	}
+	value := pe.normalize(ctx.fields, m.predicate)
+	ctx.normalized[key] = value
+	return value
+}
+
+// xmlDocument parses the request body as XML, once per request
+func (pe *PredicateEvaluator) xmlDocument(ctx *matchContext) *xmlquery.Node {
+	if ctx.xmlParsed {
+		return ctx.xmlDoc
+	}
+	ctx.xmlParsed = true
+
+	body, _ := ctx.fields["body"].(string)
+	if body == "" {
+		return nil
+	}
+
+	doc, err := xmlquery.Parse(strings.NewReader(body))
+	if err != nil {
+		pe.logger.Debugf("XML parse failed: %v", err)
+		return nil
+	}
+	ctx.xmlDoc = doc
+	return doc
+}
@@ -13,6 +13,7 @@ type ImposterRepository struct {
 	mu        sync.RWMutex
 	logger    *util.Logger
 	dataStore DataStore
+	state     *StateStore
 }
 
 // NewImposterRepository creates a new imposter repository
@@ -21,9 +22,15 @@ func NewImposterRepository(logger *util.Logger, dataStore DataStore) *ImposterRe
 		imposters: make(map[int]*Imposter),
 		logger:    logger,
 		dataStore: dataStore,
+		state:     NewStateStore(),
 	}
 }
 
+// State returns the state shared by the imposters' scripts
+func (ir *ImposterRepository) State() *StateStore {
+	return ir.state
+}
+
 // Save persists the imposter to the data store
 func (ir *ImposterRepository) Save(imposter *Imposter) error {
 	if ir.dataStore == nil {
@@ -84,6 +91,7 @@ func (ir *ImposterRepository) Delete(port int) (*Imposter, error) {
 	}
 
 	delete(ir.imposters, port)
+	ir.state.RemoveImposter(port)
 
 	// Remove from data store
 	if ir.dataStore != nil {
@@ -111,6 +119,7 @@ func (ir *ImposterRepository) DeleteAll() ([]*Imposter, error) {
 		}
 
 		imposters = append(imposters, imposter)
+		ir.state.RemoveImposter(port)
 	}
 
 	ir.imposters = make(map[int]*Imposter)
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// ScenarioStarted is the state every scenario begins in
+const ScenarioStarted = "Started"
+
+// Scenario describes the current and possible states of a scenario
+type Scenario struct {
+	Name           string   `json:"name"`
+	State          string   `json:"state"`
+	PossibleStates []string `json:"possibleStates"`
+}
+
+// ScenarioStore tracks the current state of an imposter's scenarios.
+// Scenarios not yet moved on are in ScenarioStarted.
+type ScenarioStore struct {
+	mu     sync.RWMutex
+	states map[string]string
+}
+
+// NewScenarioStore creates an empty scenario store
+func NewScenarioStore() *ScenarioStore {
+	return &ScenarioStore{states: make(map[string]string)}
+}
+
+// State returns the current state of a scenario
+func (ss *ScenarioStore) State(name string) string {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	if state, ok := ss.states[name]; ok {
+		return state
+	}
+	return ScenarioStarted
+}
+
+// CompareAndTransition moves a scenario to a new state only while it is
+// still in the expected one, reporting whether it moved. An empty expected
+// state moves the scenario from any state.
+func (ss *ScenarioStore) CompareAndTransition(name, expected, state string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	current, ok := ss.states[name]
+	if !ok {
+		current = ScenarioStarted
+	}
+	if expected != "" && current != expected {
+		return false
+	}
+	ss.states[name] = state
+	return true
+}
+
+// Reset returns a scenario to ScenarioStarted
+func (ss *ScenarioStore) Reset(name string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	delete(ss.states, name)
+}
+
+// ResetAll returns every scenario to ScenarioStarted
+func (ss *ScenarioStore) ResetAll() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.states = make(map[string]string)
+}
+
+// scenarioMatches reports whether a stub's required scenario state holds
+func (imp *Imposter) scenarioMatches(stub *Stub) bool {
+	if stub.Scenario == "" || stub.State == "" {
+		return true
+	}
+	return imp.scenarios.State(stub.Scenario) == stub.State
+}
+
+// claimScenario moves the stub's scenario on as its match is recorded, so a
+// stub removed after its predicates matched leaves the scenario alone. The
+// state is checked and moved in one step, so of two concurrent requests
+// only one can match a stub that requires the state the other moves away
+// from.
+func (imp *Imposter) claimScenario(stub *Stub) bool {
+	if stub.Scenario == "" || stub.NewState == "" {
+		return true
+	}
+	if !imp.scenarios.CompareAndTransition(stub.Scenario, stub.State, stub.NewState) {
+		return false
+	}
+	imp.logger.Debugf("Scenario %s moved to state %s", stub.Scenario, stub.NewState)
+	return true
+}
+
+// Scenarios lists the scenarios referenced by the imposter's stubs, sorted
+// by name
+func (imp *Imposter) Scenarios() []Scenario {
+	possible := make(map[string]map[string]bool)
+	addStubs := func(stubs []Stub) {
+		for _, stub := range stubs {
+			if stub.Scenario == "" {
+				continue
+			}
+			if possible[stub.Scenario] == nil {
+				possible[stub.Scenario] = map[string]bool{ScenarioStarted: true}
+			}
+			for _, state := range []string{stub.State, stub.NewState} {
+				if state != "" {
+					possible[stub.Scenario][state] = true
+				}
+			}
+		}
+	}
+
+	addStubs(imp.stubs.GetAll())
+	for _, vh := range imp.virtualHosts {
+		addStubs(vh.stubs.GetAll())
+	}
+
+	scenarios := make([]Scenario, 0, len(possible))
+	for name, states := range possible {
+		scenario := Scenario{Name: name, State: imp.scenarios.State(name)}
+		states[scenario.State] = true
+		for state := range states {
+			scenario.PossibleStates = append(scenario.PossibleStates, state)
+		}
+		sort.Strings(scenario.PossibleStates)
+		scenarios = append(scenarios, scenario)
+	}
+	sort.Slice(scenarios, func(i, j int) bool { return scenarios[i].Name < scenarios[j].Name })
+	return scenarios
+}
+
+// Scenario returns a single scenario by name
+func (imp *Imposter) Scenario(name string) (*Scenario, error) {
+	for _, scenario := range imp.Scenarios() {
+		if scenario.Name == name {
+			return &scenario, nil
+		}
+	}
+	return nil, util.NewMissingResourceError("no such scenario", name)
+}
+
+// ResetScenario returns a scenario to its initial state
+func (imp *Imposter) ResetScenario(name string) (*Scenario, error) {
+	if _, err := imp.Scenario(name); err != nil {
+		return nil, err
+	}
+	imp.scenarios.Reset(name)
+	return imp.Scenario(name)
+}
+
+// ResetScenarios returns every scenario to its initial state
+func (imp *Imposter) ResetScenarios() []Scenario {
+	imp.scenarios.ResetAll()
+	return imp.Scenarios()
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"container/list"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrScriptTimeout is returned when a script runs longer than its timeout
+var ErrScriptTimeout = errors.New("timeout")
+
+// ErrScriptStackOverflow is returned when a script exceeds the call stack limit
+var ErrScriptStackOverflow = errors.New("maximum call stack size exceeded")
+
+// defaultScriptRuntimes bounds the runtimes an imposter keeps for injection
+var defaultScriptRuntimes = 2 * runtime.GOMAXPROCS(0)
+
+// maxCachedPrograms bounds how many compiled scripts an engine keeps. The
+// least recently used are dropped beyond it, so scripts that change on every
+// stub update do not pile up.
+const maxCachedPrograms = 256
+
+// maxScriptCallStack caps the call depth of scripts, so runaway recursion
+// fails instead of exhausting memory
+const maxScriptCallStack = 1024
+
+// scriptInterrupts counts scripts stopped for running away
+var scriptInterrupts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "mb_injection_interrupted_total",
+	Help: "Injected scripts stopped for exceeding their timeout or maximum call stack size",
+}, []string{"imposter", "reason"})
+
+// ScriptOptions configures a ScriptEngine
+type ScriptOptions struct {
+	// Runtimes is the most runtimes kept at once
+	Runtimes int
+
+	// Timeout interrupts scripts running longer; zero means no limit
+	Timeout time.Duration
+
+	// Name identifies the engine in metrics, usually the imposter port
+	Name string
+
+	// ModulesDir is the directory require loads modules from; without it
+	// only the built-in modules are available
+	ModulesDir string
+}
+
+// ScriptEngine runs injected JavaScript. Each script is compiled once into
+// a program, and programs run on runtimes borrowed from a bounded pool
+// instead of a new runtime per call. A runtime whose globals a script
+// changed is discarded rather than reused, and scripts arriving while every
+// pooled runtime is busy run on a temporary one instead of waiting.
+type ScriptEngine struct {
+	options ScriptOptions
+	modules *moduleLoader
+
+	// programs and order cache compiled scripts, most recently used first
+	mu       sync.Mutex
+	programs map[string]*list.Element
+	order    *list.List
+
+	// idle holds runtimes ready for use; slots limits how many exist
+	idle  chan *pooledRuntime
+	slots chan struct{}
+}
+
+// cachedProgram is a compiled script in the least recently used order
+type cachedProgram struct {
+	source  string
+	program *goja.Program
+}
+
+// pooledRuntime is a runtime kept by the pool, with the globals it was
+// created with. Temporary runtimes are dropped after use.
+type pooledRuntime struct {
+	vm        *goja.Runtime
+	names     []string
+	values    []goja.Value
+	temporary bool
+}
+
+// NewScriptEngine creates a script engine
+func NewScriptEngine(options ScriptOptions) *ScriptEngine {
+	if options.Runtimes < 1 {
+		options.Runtimes = 1
+	}
+	return &ScriptEngine{
+		options:  options,
+		modules:  newModuleLoader(options.ModulesDir),
+		programs: make(map[string]*list.Element),
+		order:    list.New(),
+		idle:     make(chan *pooledRuntime, options.Runtimes),
+		slots:    make(chan struct{}, options.Runtimes),
+	}
+}
+
+// Run runs source with the globals returned by setup, then hands the
+// result to use while the runtime is still held. The script's state session
+// is released while it waits on timers. The globals are removed
+// again before the runtime goes back to the pool, so scripts only see what
+// their own caller set up, and a runtime left with other changes to its
+// globals is discarded. Scripts may finish asynchronously, by returning a
+// promise or calling callback, and have setTimeout for scheduling work. A
+// script exceeding the timeout, waiting included, fails with
+// ErrScriptTimeout.
+func (e *ScriptEngine) Run(source string, session *stateSession, setup func(vm *goja.Runtime) map[string]interface{}, use func(vm *goja.Runtime, result goja.Value) error) error {
+	program, err := e.compile(source)
+	if err != nil {
+		return err
+	}
+
+	pooled := e.acquire()
+	defer e.release(pooled)
+	vm := pooled.vm
+
+	globals := setup(vm)
+	for name, value := range globals {
+		vm.Set(name, value)
+	}
+	defer func() {
+		for name := range globals {
+			vm.GlobalObject().Delete(name)
+		}
+	}()
+
+	expired, stop := interruptAfter(vm, e.options.Timeout)
+	result, err := runAsync(vm, expired, session, func() (goja.Value, error) {
+		return vm.RunProgram(program)
+	})
+	if err == nil {
+		err = use(vm, result)
+	}
+	stop()
+
+	return e.checkRunaway(err)
+}
+
+// interruptAfter interrupts the runtime and closes the returned channel
+// once timeout passes; zero means no limit. The returned function cancels
+// the timer and leaves the runtime reusable.
+func interruptAfter(vm *goja.Runtime, timeout time.Duration) (<-chan struct{}, func()) {
+	if timeout <= 0 {
+		return nil, func() {}
+	}
+
+	var mu sync.Mutex
+	finished := false
+	expired := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !finished {
+			close(expired)
+			vm.Interrupt(ErrScriptTimeout)
+		}
+	})
+
+	return expired, func() {
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		timer.Stop()
+		vm.ClearInterrupt()
+	}
+}
+
+// checkRunaway counts scripts stopped by the timeout or the call stack
+// limit, reducing them to ErrScriptTimeout and ErrScriptStackOverflow
+func (e *ScriptEngine) checkRunaway(err error) error {
+	var overflow *goja.StackOverflowError
+	switch {
+	case errors.Is(err, ErrScriptTimeout):
+		scriptInterrupts.WithLabelValues(e.options.Name, "timeout").Inc()
+		return ErrScriptTimeout
+	case errors.As(err, &overflow):
+		scriptInterrupts.WithLabelValues(e.options.Name, "stack").Inc()
+		return ErrScriptStackOverflow
+	}
+	return err
+}
+
+// compile returns the program for source, compiling it on first use
+func (e *ScriptEngine) compile(source string) (*goja.Program, error) {
+	e.mu.Lock()
+	if element, ok := e.programs[source]; ok {
+		e.order.MoveToFront(element)
+		e.mu.Unlock()
+		return element.Value.(*cachedProgram).program, nil
+	}
+	e.mu.Unlock()
+
+	program, err := goja.Compile("", source, false)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if element, ok := e.programs[source]; ok {
+		e.order.MoveToFront(element)
+		return element.Value.(*cachedProgram).program, nil
+	}
+	e.programs[source] = e.order.PushFront(&cachedProgram{source: source, program: program})
+	if e.order.Len() > maxCachedPrograms {
+		oldest := e.order.Back()
+		e.order.Remove(oldest)
+		delete(e.programs, oldest.Value.(*cachedProgram).source)
+	}
+	return program, nil
+}
+
+// acquire takes an idle runtime, creates one while below the limit, or
+// creates a temporary one when the pool is full, so a script waiting on a
+// slow one never holds up the rest
+func (e *ScriptEngine) acquire() *pooledRuntime {
+	select {
+	case pooled := <-e.idle:
+		return pooled
+	case e.slots <- struct{}{}:
+		return e.newRuntime()
+	default:
+	}
+
+	pooled := e.newRuntime()
+	pooled.temporary = true
+	return pooled
+}
+
+// newRuntime creates a runtime and records the globals it is checked
+// against on release
+func (e *ScriptEngine) newRuntime() *pooledRuntime {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(maxScriptCallStack)
+	e.modules.install(vm)
+
+	pooled := &pooledRuntime{vm: vm}
+	global := vm.GlobalObject()
+	pooled.names = global.GetOwnPropertyNames()
+	for _, name := range pooled.names {
+		pooled.values = append(pooled.values, global.Get(name))
+	}
+	return pooled
+}
+
+// pristine reports whether the runtime still has exactly the globals it was
+// created with. Changes to built-in prototypes are not checked, as walking
+// them costs more than the scripts themselves.
+func (r *pooledRuntime) pristine() bool {
+	global := r.vm.GlobalObject()
+	names := global.GetOwnPropertyNames()
+	if len(names) != len(r.names) {
+		return false
+	}
+	for i, name := range names {
+		if name != r.names[i] || !global.Get(name).SameAs(r.values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// release returns a runtime to the pool, or discards it when it is
+// temporary or the script changed its globals, so the next script starts
+// clean
+func (e *ScriptEngine) release(pooled *pooledRuntime) {
+	if pooled.temporary {
+		return
+	}
+	if !pooled.pristine() {
+		<-e.slots
+		return
+	}
+	e.idle <- pooled
+}
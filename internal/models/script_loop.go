@@ -0,0 +1,203 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// ErrScriptUnresolved is returned when a script is left waiting on a promise
+// or callback with no timers remaining that could settle it
+var ErrScriptUnresolved = errors.New("script never resolved its promise or called callback")
+
+// maxScriptWait caps how long a script without a timeout may wait on its
+// timers, so it cannot hold its runtime forever
+const maxScriptWait = time.Minute
+
+// eventLoop runs the timers of a single script invocation, so scripts can
+// finish asynchronously by returning a promise or calling callback
+type eventLoop struct {
+	vm      *goja.Runtime
+	session *stateSession
+	timers  []*loopTimer
+	nextID  int64
+
+	// called and value record the first call to callback
+	called bool
+	value  goja.Value
+}
+
+// loopTimer is a function scheduled by setTimeout
+type loopTimer struct {
+	id   int64
+	due  time.Time
+	fn   goja.Callable
+	args []goja.Value
+}
+
+// loopGlobals are the globals an event loop provides while it runs
+var loopGlobals = []string{"setTimeout", "clearTimeout", "callback"}
+
+// runAsync calls run with setTimeout, clearTimeout and callback available,
+// then runs timers until the result settles. A returned promise settles when
+// it is fulfilled or rejected. Otherwise the first value passed to callback
+// wins, and a script returning undefined while timers are pending is waited
+// on to call it. Waiting ends with ErrScriptTimeout once expired is closed,
+// or after maxScriptWait when there is no timeout. The state session, if
+// any, is paused while the loop waits for a timer.
+func runAsync(vm *goja.Runtime, expired <-chan struct{}, session *stateSession, run func() (goja.Value, error)) (goja.Value, error) {
+	loop := &eventLoop{vm: vm, session: session}
+	vm.Set("setTimeout", loop.setTimeout)
+	vm.Set("clearTimeout", loop.clearTimeout)
+	vm.Set("callback", loop.callback)
+	defer func() {
+		for _, name := range loopGlobals {
+			vm.GlobalObject().Delete(name)
+		}
+	}()
+
+	result, err := run()
+	if err != nil {
+		return nil, err
+	}
+
+	if expired == nil {
+		ceiling := make(chan struct{})
+		timer := time.AfterFunc(maxScriptWait, func() { close(ceiling) })
+		defer timer.Stop()
+		expired = ceiling
+	}
+	return loop.wait(result, expired)
+}
+
+// wait runs timers until result settles
+func (l *eventLoop) wait(result goja.Value, expired <-chan struct{}) (goja.Value, error) {
+	for {
+		if l.called {
+			return l.value, nil
+		}
+
+		if promise, ok := exportPromise(result); ok {
+			switch promise.State() {
+			case goja.PromiseStateFulfilled:
+				return promise.Result(), nil
+			case goja.PromiseStateRejected:
+				return nil, promiseRejection(promise.Result())
+			}
+		} else if !util.IsUndefined(result) || len(l.timers) == 0 {
+			return result, nil
+		}
+
+		if len(l.timers) == 0 {
+			return nil, ErrScriptUnresolved
+		}
+		if err := l.runNextTimer(expired); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// runNextTimer waits for the earliest timer and runs it
+func (l *eventLoop) runNextTimer(expired <-chan struct{}) error {
+	next := 0
+	for i, timer := range l.timers {
+		if timer.due.Before(l.timers[next].due) {
+			next = i
+		}
+	}
+	timer := l.timers[next]
+	l.timers = append(l.timers[:next], l.timers[next+1:]...)
+
+	if delay := time.Until(timer.due); delay > 0 {
+		if err := l.sleep(delay, expired); err != nil {
+			return err
+		}
+	}
+
+	_, err := timer.fn(goja.Undefined(), timer.args...)
+	return err
+}
+
+// sleep waits for delay with the script's state released, so other scripts
+// can use it meanwhile, failing with ErrScriptTimeout once expired is closed
+func (l *eventLoop) sleep(delay time.Duration, expired <-chan struct{}) error {
+	l.session.pause()
+	defer l.session.resume()
+
+	wait := time.NewTimer(delay)
+	defer wait.Stop()
+	select {
+	case <-wait.C:
+		return nil
+	case <-expired:
+		return ErrScriptTimeout
+	}
+}
+
+// setTimeout schedules a function after a delay in milliseconds
+func (l *eventLoop) setTimeout(call goja.FunctionCall) goja.Value {
+	fn, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		panic(l.vm.NewTypeError("setTimeout requires a function"))
+	}
+
+	delay := time.Duration(call.Argument(1).ToInteger()) * time.Millisecond
+	if delay < 0 {
+		delay = 0
+	}
+
+	var args []goja.Value
+	if len(call.Arguments) > 2 {
+		args = call.Arguments[2:]
+	}
+
+	l.nextID++
+	l.timers = append(l.timers, &loopTimer{
+		id:   l.nextID,
+		due:  time.Now().Add(delay),
+		fn:   fn,
+		args: args,
+	})
+	return l.vm.ToValue(l.nextID)
+}
+
+// clearTimeout cancels a timer scheduled by setTimeout
+func (l *eventLoop) clearTimeout(call goja.FunctionCall) goja.Value {
+	id := call.Argument(0).ToInteger()
+	for i, timer := range l.timers {
+		if timer.id == id {
+			l.timers = append(l.timers[:i], l.timers[i+1:]...)
+			break
+		}
+	}
+	return goja.Undefined()
+}
+
+// callback settles the script with its argument
+func (l *eventLoop) callback(call goja.FunctionCall) goja.Value {
+	if !l.called {
+		l.called = true
+		l.value = call.Argument(0)
+	}
+	return goja.Undefined()
+}
+
+// exportPromise returns the promise held by value, if any
+func exportPromise(value goja.Value) (*goja.Promise, bool) {
+	if value == nil {
+		return nil, false
+	}
+	promise, ok := value.Export().(*goja.Promise)
+	return promise, ok
+}
+
+// promiseRejection turns a rejected promise's reason into an error
+func promiseRejection(reason goja.Value) error {
+	if reason == nil || util.IsUndefined(reason) {
+		return errors.New("promise rejected")
+	}
+	return fmt.Errorf("promise rejected: %s", reason.String())
+}
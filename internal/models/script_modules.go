@@ -0,0 +1,228 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// builtinModules can be required without a modules directory
+var builtinModules = map[string]func(vm *goja.Runtime) goja.Value{
+	"buffer": func(vm *goja.Runtime) goja.Value {
+		module := vm.NewObject()
+		module.Set("Buffer", newBufferObject(vm))
+		return module
+	},
+	"crypto": newCryptoModule,
+}
+
+// hashAlgorithms are the algorithms crypto.createHash supports
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// moduleLoader resolves require calls to the built-in modules and to
+// CommonJS modules inside a modules directory. Compiled modules are shared by
+// every runtime, while each runtime keeps its own module instances.
+type moduleLoader struct {
+	dir      string
+	programs sync.Map
+}
+
+// newModuleLoader creates a loader for modules in dir; without a dir only
+// the built-in modules can be required
+func newModuleLoader(dir string) *moduleLoader {
+	if dir != "" {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = real
+		}
+	}
+	return &moduleLoader{dir: dir}
+}
+
+// install gives the runtime a require function with its own module cache
+func (l *moduleLoader) install(vm *goja.Runtime) {
+	cache := make(map[string]*goja.Object)
+	vm.Set("require", l.requireFrom(vm, cache, l.dir))
+}
+
+// requireFrom creates the require function for code in dir
+func (l *moduleLoader) requireFrom(vm *goja.Runtime, cache map[string]*goja.Object, dir string) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		name := call.Argument(0).String()
+
+		key := name
+		newBuiltin, builtin := builtinModules[name]
+		if !builtin {
+			path, err := l.resolve(dir, name)
+			if err != nil {
+				panic(newScriptError(vm, err))
+			}
+			key = path
+		}
+
+		if module, ok := cache[key]; ok {
+			return module.Get("exports")
+		}
+
+		module := vm.NewObject()
+		if builtin {
+			module.Set("exports", newBuiltin(vm))
+			cache[key] = module
+			return module.Get("exports")
+		}
+
+		// Cache before running so circular requires see partial exports,
+		// as in Node
+		module.Set("exports", vm.NewObject())
+		cache[key] = module
+		if err := l.load(vm, cache, key, module); err != nil {
+			delete(cache, key)
+			switch err.(type) {
+			case *goja.Exception, *goja.InterruptedError, *goja.StackOverflowError:
+				panic(err)
+			}
+			panic(newScriptError(vm, err))
+		}
+		return module.Get("exports")
+	}
+}
+
+// resolve finds the file for a module name required from dir
+func (l *moduleLoader) resolve(dir, name string) (string, error) {
+	if l.dir == "" {
+		return "", fmt.Errorf("cannot find module '%s': only built-in modules can be required unless mb is run with --modulesDir", name)
+	}
+
+	base := filepath.Join(l.dir, name)
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		base = filepath.Join(dir, name)
+	} else if filepath.IsAbs(name) {
+		base = filepath.Clean(name)
+	}
+
+	for _, candidate := range []string{base, base + ".js", base + ".json", filepath.Join(base, "index.js")} {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		real, err := filepath.EvalSymlinks(candidate)
+		if err != nil {
+			continue
+		}
+		if !l.contains(real) {
+			return "", fmt.Errorf("cannot require '%s': outside the modules directory", name)
+		}
+		return real, nil
+	}
+	return "", fmt.Errorf("cannot find module '%s'", name)
+}
+
+// contains reports whether path is inside the modules directory
+func (l *moduleLoader) contains(path string) bool {
+	rel, err := filepath.Rel(l.dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// load runs a module file, filling in module.exports
+func (l *moduleLoader) load(vm *goja.Runtime, cache map[string]*goja.Object, path string, module *goja.Object) error {
+	program, err := l.compile(path)
+	if err != nil {
+		return err
+	}
+
+	wrapper, err := vm.RunProgram(program)
+	if err != nil {
+		return err
+	}
+	fn, _ := goja.AssertFunction(wrapper)
+
+	dir := filepath.Dir(path)
+	_, err = fn(module, module.Get("exports"), vm.ToValue(l.requireFrom(vm, cache, dir)), module, vm.ToValue(path), vm.ToValue(dir))
+	return err
+}
+
+// compile returns the program for a module file, compiling it on first use.
+// JSON files become modules exporting their parsed contents.
+func (l *moduleLoader) compile(path string) (*goja.Program, error) {
+	if program, ok := l.programs.Load(path); ok {
+		return program.(*goja.Program), nil
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	body := string(source)
+	if filepath.Ext(path) == ".json" {
+		body = "module.exports = " + body + ";"
+	}
+	wrapped := "(function (exports, require, module, __filename, __dirname) {" + body + "\n})"
+
+	program, err := goja.Compile(path, wrapped, false)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := l.programs.LoadOrStore(path, program)
+	return actual.(*goja.Program), nil
+}
+
+// newScriptError creates a JavaScript Error carrying err's message
+func newScriptError(vm *goja.Runtime, err error) *goja.Object {
+	errorObj, _ := vm.New(vm.Get("Error"), vm.ToValue(err.Error()))
+	return errorObj
+}
+
+// newCryptoModule provides Node-style createHash and createHmac
+func newCryptoModule(vm *goja.Runtime) goja.Value {
+	newHash := func(name string) func() hash.Hash {
+		algorithm, ok := hashAlgorithms[strings.ToLower(name)]
+		if !ok {
+			panic(vm.NewTypeError("unsupported hash algorithm: %s", name))
+		}
+		return algorithm
+	}
+
+	crypto := vm.NewObject()
+	crypto.Set("createHash", func(call goja.FunctionCall) goja.Value {
+		return newHashObject(vm, newHash(call.Argument(0).String())())
+	})
+	crypto.Set("createHmac", func(call goja.FunctionCall) goja.Value {
+		key := []byte(call.Argument(1).String())
+		return newHashObject(vm, hmac.New(newHash(call.Argument(0).String()), key))
+	})
+	return crypto
+}
+
+// newHashObject wraps a hash in an object with update and digest
+func newHashObject(vm *goja.Runtime, h hash.Hash) *goja.Object {
+	hashObj := vm.NewObject()
+	hashObj.Set("update", func(call goja.FunctionCall) goja.Value {
+		h.Write([]byte(call.Argument(0).String()))
+		return hashObj
+	})
+	hashObj.Set("digest", func(call goja.FunctionCall) goja.Value {
+		if encoding := call.Argument(0); !goja.IsUndefined(encoding) {
+			return vm.ToValue(encodeBytes(h.Sum(nil), encoding.String()))
+		}
+		return newBufferInstance(vm, h.Sum(nil))
+	})
+	return hashObj
+}
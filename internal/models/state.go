@@ -0,0 +1,369 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/dop251/goja"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// GlobalStateNamespace names the namespace shared by every imposter
+const GlobalStateNamespace = "global"
+
+// StateStore holds the state scripts keep between requests: a namespace per
+// imposter and a global namespace every imposter can reach
+type StateStore struct {
+	mu        sync.Mutex
+	global    *StateNamespace
+	imposters map[int]*StateNamespace
+
+	// dataStore persists namespaces as they change, when set
+	dataStore DataStore
+	logger    *util.Logger
+}
+
+// StateNamespace is one independently locked set of state values
+type StateNamespace struct {
+	name    string
+	store   *StateStore
+	mu      sync.Mutex
+	values  map[string]interface{}
+	version int
+
+	// saveMu orders saves, which run outside mu; saved is the version last
+	// written to the data store
+	saveMu sync.Mutex
+	saved  int
+}
+
+// stateChange is a copy of a namespace's values, taken under its lock, for
+// saving once the lock is released
+type stateChange struct {
+	version int
+	values  map[string]interface{}
+	err     error
+}
+
+// ScriptState is the state an imposter's scripts can reach
+type ScriptState struct {
+	Imposter *StateNamespace
+	Global   *StateNamespace
+}
+
+// NewStateStore creates an empty state store
+func NewStateStore() *StateStore {
+	ss := &StateStore{imposters: make(map[int]*StateNamespace)}
+	ss.global = ss.newNamespace(GlobalStateNamespace)
+	return ss
+}
+
+// Persist loads the state held by the data store, then saves each namespace
+// back to it whenever it changes
+func (ss *StateStore) Persist(dataStore DataStore, logger *util.Logger) error {
+	saved, err := dataStore.LoadState()
+	if err != nil {
+		return err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for name, values := range saved {
+		if values == nil {
+			continue
+		}
+		if name == GlobalStateNamespace {
+			ss.global.values = values
+			continue
+		}
+		port, err := strconv.Atoi(name)
+		if err != nil {
+			logger.Warnf("Ignoring saved state for unknown namespace %s", name)
+			continue
+		}
+		ns := ss.newNamespace(name)
+		ns.values = values
+		ss.imposters[port] = ns
+	}
+
+	ss.dataStore = dataStore
+	ss.logger = logger
+	return nil
+}
+
+// Global returns the namespace shared by every imposter
+func (ss *StateStore) Global() *StateNamespace {
+	return ss.global
+}
+
+// Imposter returns the namespace of the imposter on port, creating it if needed
+func (ss *StateStore) Imposter(port int) *StateNamespace {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ns, ok := ss.imposters[port]
+	if !ok {
+		ns = ss.newNamespace(strconv.Itoa(port))
+		ss.imposters[port] = ns
+	}
+	return ns
+}
+
+// RemoveImposter forgets the namespace of a deleted imposter
+func (ss *StateStore) RemoveImposter(port int) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	delete(ss.imposters, port)
+}
+
+// ForScripts returns the state scripts of the imposter on port can reach
+func (ss *StateStore) ForScripts(port int) ScriptState {
+	return ScriptState{Imposter: ss.Imposter(port), Global: ss.global}
+}
+
+func (ss *StateStore) newNamespace(name string) *StateNamespace {
+	return &StateNamespace{name: name, store: ss, values: make(map[string]interface{})}
+}
+
+// Values returns a copy of the namespace's values
+func (ns *StateNamespace) Values() (map[string]interface{}, error) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	return copyState(ns.values)
+}
+
+// Replace swaps the namespace's values for new ones
+func (ns *StateNamespace) Replace(values map[string]interface{}) {
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+
+	ns.mu.Lock()
+	ns.values = values
+	change := ns.change()
+	ns.mu.Unlock()
+
+	ns.save(change)
+}
+
+// Clear removes every value from the namespace
+func (ns *StateNamespace) Clear() {
+	ns.Replace(nil)
+}
+
+// persistence returns the data store namespaces are saved to, if any
+func (ss *StateStore) persistence() (DataStore, *util.Logger) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.dataStore, ss.logger
+}
+
+// change records that the values changed and copies them for saving when
+// state is persisted; callers hold ns.mu
+func (ns *StateNamespace) change() *stateChange {
+	ns.version++
+	if dataStore, _ := ns.store.persistence(); dataStore == nil {
+		return nil
+	}
+
+	values, err := copyState(ns.values)
+	return &stateChange{version: ns.version, values: values, err: err}
+}
+
+// save persists a change without holding ns.mu, so slow data stores do not
+// block scripts. A change older than the one last saved is skipped.
+func (ns *StateNamespace) save(change *stateChange) {
+	if change == nil {
+		return
+	}
+	dataStore, logger := ns.store.persistence()
+
+	ns.saveMu.Lock()
+	defer ns.saveMu.Unlock()
+
+	if change.version <= ns.saved {
+		return
+	}
+	err := change.err
+	if err == nil {
+		err = dataStore.SaveState(ns.name, change.values)
+	}
+	if err != nil {
+		logger.Errorf("Failed to save %s state: %v", ns.name, err)
+		return
+	}
+	ns.saved = change.version
+}
+
+// copyState deep copies state values through JSON, which is also the form
+// they are served and persisted in
+func copyState(values map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var copied map[string]interface{}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, err
+	}
+	if copied == nil {
+		copied = make(map[string]interface{})
+	}
+	return copied, nil
+}
+
+// snapshot returns copies of both namespaces for use outside of scripts,
+// such as template data. Values that cannot be copied are left out.
+func (s ScriptState) snapshot() (imposter, global map[string]interface{}) {
+	imposter, _ = s.Imposter.Values()
+	global, _ = s.Global.Values()
+	return imposter, global
+}
+
+// session starts the state access of one script run
+func (s ScriptState) session() *stateSession {
+	return &stateSession{namespaces: [2]*StateNamespace{s.Imposter, s.Global}}
+}
+
+// stateSession gives one script run access to state. Each namespace is
+// locked the first time the script touches it and stays locked while the
+// script runs, so reads and writes between waits are never interleaved with
+// those of other scripts. The locks are released while the script waits on
+// a timer and taken again before it continues. The imposter namespace is
+// always locked before the global one, so two scripts cannot deadlock on
+// each other.
+type stateSession struct {
+	namespaces [2]*StateNamespace
+	locked     [2]bool
+	paused     [2]bool
+	dirty      [2]bool
+}
+
+const (
+	imposterNamespace = iota
+	globalNamespace
+)
+
+// objects returns the JavaScript views of the imposter and global namespaces
+func (s *stateSession) objects(vm *goja.Runtime) (*goja.Object, *goja.Object) {
+	return vm.NewDynamicObject(&stateObject{vm: vm, session: s, namespace: imposterNamespace}),
+		vm.NewDynamicObject(&stateObject{vm: vm, session: s, namespace: globalNamespace})
+}
+
+// values locks a namespace if needed and returns its values
+func (s *stateSession) values(namespace int) map[string]interface{} {
+	for i := 0; i <= namespace; i++ {
+		if !s.locked[i] {
+			s.namespaces[i].mu.Lock()
+			s.locked[i] = true
+		}
+	}
+	return s.namespaces[namespace].values
+}
+
+// pause unlocks the namespaces while the script waits
+func (s *stateSession) pause() {
+	if s == nil {
+		return
+	}
+	for i := len(s.namespaces) - 1; i >= 0; i-- {
+		if s.locked[i] {
+			s.namespaces[i].mu.Unlock()
+			s.locked[i] = false
+			s.paused[i] = true
+		}
+	}
+}
+
+// resume locks the namespaces pause released, before the script continues
+func (s *stateSession) resume() {
+	if s == nil {
+		return
+	}
+	for i := range s.namespaces {
+		if s.paused[i] {
+			s.namespaces[i].mu.Lock()
+			s.locked[i] = true
+			s.paused[i] = false
+		}
+	}
+}
+
+// close unlocks the namespaces, then saves those the script may have changed
+func (s *stateSession) close() {
+	var changes [2]*stateChange
+	for i := len(s.namespaces) - 1; i >= 0; i-- {
+		if !s.locked[i] {
+			continue
+		}
+		if s.dirty[i] {
+			changes[i] = s.namespaces[i].change()
+		}
+		s.namespaces[i].mu.Unlock()
+		s.locked[i] = false
+	}
+
+	for i, change := range changes {
+		if change != nil {
+			s.namespaces[i].save(change)
+		}
+	}
+}
+
+// stateObject exposes a namespace to scripts as a plain object
+type stateObject struct {
+	vm        *goja.Runtime
+	session   *stateSession
+	namespace int
+}
+
+func (o *stateObject) Get(key string) goja.Value {
+	value, ok := o.session.values(o.namespace)[key]
+	if !ok {
+		return nil
+	}
+
+	// Objects and arrays can be changed in place through the returned value
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		o.session.dirty[o.namespace] = true
+	}
+	return o.vm.ToValue(value)
+}
+
+func (o *stateObject) Set(key string, value goja.Value) bool {
+	o.session.values(o.namespace)[key] = value.Export()
+	o.session.dirty[o.namespace] = true
+	return true
+}
+
+func (o *stateObject) Has(key string) bool {
+	_, ok := o.session.values(o.namespace)[key]
+	return ok
+}
+
+func (o *stateObject) Delete(key string) bool {
+	delete(o.session.values(o.namespace), key)
+	o.session.dirty[o.namespace] = true
+	return true
+}
+
+func (o *stateObject) Keys() []string {
+	values := o.session.values(o.namespace)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// State returns the imposter's own state namespace
+func (imp *Imposter) State() *StateNamespace {
+	return imp.state.Imposter
+}
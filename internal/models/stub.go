@@ -1,7 +1,11 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/mountebank-testing/mountebank-go/internal/util"
 )
@@ -13,42 +17,187 @@ type StubRepository struct {
 	mu       sync.RWMutex
 	logger   *util.Logger
 	onUpdate func()
+
+	// encoding is the imposter encoding predicates are compiled for
+	encoding string
+
+	// index is built on demand and dropped whenever the stubs change
+	index *stubIndex
 }
 
-// NewStubRepository creates a new stub repository
-func NewStubRepository(stubs []Stub, requests []*Request, logger *util.Logger, onUpdate func()) *StubRepository {
+// NewStubRepository creates a new stub repository. The stubs must already
+// have been checked with ValidateStubs for the imposter encoding, which
+// compiles their predicates; stubs added later are checked as they are
+// stored.
+func NewStubRepository(stubs []Stub, requests []*Request, encoding string, logger *util.Logger, onUpdate func()) *StubRepository {
 	if requests == nil {
 		requests = make([]*Request, 0)
 	}
+	initStubs(stubs)
 	return &StubRepository{
 		stubs:    stubs,
 		requests: requests,
 		logger:   logger,
 		onUpdate: onUpdate,
+		encoding: encoding,
 	}
 }
 
-// First finds the first stub matching the filter
-func (sr *StubRepository) First(filter func([]Predicate) bool) (*StubMatch, error) {
-	sr.mu.RLock()
-	defer sr.mu.RUnlock()
-	
-	for i, stub := range sr.stubs {
-		if filter(stub.Predicates) {
-			return &StubMatch{
-				Success:   true,
-				Stub:      &sr.stubs[i],
-				StubIndex: i,
-			}, nil
-		}
-	}
-	
-	// Return no match
-	return &StubMatch{
+// First finds the first enabled stub matching the filter. When a request is
+// given, only stubs whose method and path predicates could match it are
+// tried. Stubs that have outlived their ttlSeconds or used up their
+// expiresAfterMatches are skipped and removed.
+//
+// The filter runs on copies of the candidate stubs without holding the lock,
+// since predicates may run scripts. The lock is only taken again to record
+// the match, so a stub changed or removed in the meantime is skipped. claim,
+// when given, runs under that lock once the stub is known to still exist,
+// and the stub is skipped if it returns false.
+func (sr *StubRepository) First(request *Request, filter func(*Stub) bool, claim func(*Stub) bool) (*StubMatch, error) {
+	candidates, removed := sr.snapshot(request)
+
+	// Return no match unless a stub matches
+	match := &StubMatch{
 		Success:   false,
 		Stub:      nil,
 		StubIndex: -1,
-	}, nil
+	}
+	for i := range candidates {
+		if !candidates[i].IsEnabled() || !filter(&candidates[i]) {
+			continue
+		}
+
+		matched, index, exhausted := sr.recordMatch(candidates[i].ID, claim)
+		if index < 0 {
+			continue
+		}
+		removed = removed || exhausted
+		match = &StubMatch{
+			Success:   true,
+			Stub:      matched,
+			StubIndex: index,
+		}
+		break
+	}
+
+	// Save outside the lock, since saving reads the stubs
+	if removed && sr.onUpdate != nil {
+		sr.onUpdate()
+	}
+	return match, nil
+}
+
+// snapshot copies the stubs worth trying for a request, removing expired
+// stubs first. It reports whether any stubs were removed.
+func (sr *StubRepository) snapshot(request *Request) ([]Stub, bool) {
+	now := time.Now()
+
+	sr.mu.RLock()
+	if sr.index != nil && !sr.index.expired(now) {
+		defer sr.mu.RUnlock()
+		return sr.copyCandidates(request), false
+	}
+	sr.mu.RUnlock()
+
+	// Rebuilding the index or removing stubs needs the write lock
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	removed := false
+	if sr.currentIndex().expired(now) {
+		removed = sr.removeExpired(now)
+	}
+	return sr.copyCandidates(request), removed
+}
+
+// copyCandidates copies the candidate stubs for a request in order
+func (sr *StubRepository) copyCandidates(request *Request) []Stub {
+	indexes := sr.candidates(request)
+	result := make([]Stub, len(indexes))
+	for i, index := range indexes {
+		result[i] = sr.stubs[index]
+	}
+	return result
+}
+
+// recordMatch counts a match against the stub with the given id, removing it
+// once it has used up its expiresAfterMatches. It returns a copy of the
+// stub and its index, or -1 if the stub is gone or not claimed, and whether
+// it was removed.
+func (sr *StubRepository) recordMatch(id string, claim func(*Stub) bool) (*Stub, int, bool) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	index := sr.indexOf(id)
+	if index < 0 {
+		return nil, -1, false
+	}
+	if claim != nil && !claim(&sr.stubs[index]) {
+		return nil, -1, false
+	}
+
+	stub := &sr.stubs[index]
+	stub.matchCount++
+	matched := *stub
+	if stub.ExpiresAfterMatches == nil || stub.matchCount < *stub.ExpiresAfterMatches {
+		return &matched, index, false
+	}
+
+	// Build a new slice, since earlier ones may still be in use
+	sr.logger.Debugf("Removing stub %s: exhausted after %d matches", stub.ID, stub.matchCount)
+	kept := make([]Stub, 0, len(sr.stubs)-1)
+	kept = append(kept, sr.stubs[:index]...)
+	sr.stubs = append(kept, sr.stubs[index+1:]...)
+	sr.index = nil
+	return &matched, index, true
+}
+
+// candidates returns the indexes of the stubs worth trying for a request in
+// order. Without a request every stub is a candidate.
+func (sr *StubRepository) candidates(request *Request) []int {
+	if request == nil {
+		all := make([]int, len(sr.stubs))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	return sr.currentIndex().candidates(request)
+}
+
+// currentIndex returns the stub index, rebuilding it if the stubs changed
+func (sr *StubRepository) currentIndex() *stubIndex {
+	if sr.index == nil {
+		sr.index = newStubIndex(sr.stubs)
+	}
+	return sr.index
+}
+
+// removeExpired removes stubs whose time to live has passed, reporting
+// whether any were removed
+func (sr *StubRepository) removeExpired(now time.Time) bool {
+	expired := func(stub *Stub) bool {
+		return stub.TTLSeconds != nil && now.Sub(stub.addedAt) >= time.Duration(*stub.TTLSeconds)*time.Second
+	}
+
+	for i := range sr.stubs {
+		if !expired(&sr.stubs[i]) {
+			continue
+		}
+
+		kept := make([]Stub, 0, len(sr.stubs))
+		for j := range sr.stubs {
+			if j >= i && expired(&sr.stubs[j]) {
+				sr.logger.Debugf("Removing stub %s: expired after %ds", sr.stubs[j].ID, *sr.stubs[j].TTLSeconds)
+				continue
+			}
+			kept = append(kept, sr.stubs[j])
+		}
+		sr.stubs = kept
+		sr.index = nil
+		return true
+	}
+	return false
 }
 
 // Add adds a new stub
@@ -56,7 +205,11 @@ func (sr *StubRepository) Add(stub Stub) error {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 	
+	if err := sr.prepare(&stub, -1); err != nil {
+		return err
+	}
 	sr.stubs = append(sr.stubs, stub)
+	sr.index = nil
 	if sr.onUpdate != nil {
 		sr.onUpdate()
 	}
@@ -68,8 +221,12 @@ func (sr *StubRepository) InsertAtIndex(stub Stub, index int) error {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 	
+	if err := sr.prepare(&stub, -1); err != nil {
+		return err
+	}
 	if index < 0 || index > len(sr.stubs) {
 		sr.stubs = append(sr.stubs, stub)
+		sr.index = nil
 		if sr.onUpdate != nil {
 			sr.onUpdate()
 		}
@@ -78,6 +235,7 @@ func (sr *StubRepository) InsertAtIndex(stub Stub, index int) error {
 	
 	// Insert at index
 	sr.stubs = append(sr.stubs[:index], append([]Stub{stub}, sr.stubs[index:]...)...)
+	sr.index = nil
 	if sr.onUpdate != nil {
 		sr.onUpdate()
 	}
@@ -94,6 +252,7 @@ func (sr *StubRepository) DeleteAtIndex(index int) error {
 	}
 	
 	sr.stubs = append(sr.stubs[:index], sr.stubs[index+1:]...)
+	sr.index = nil
 	if sr.onUpdate != nil {
 		sr.onUpdate()
 	}
@@ -109,7 +268,14 @@ func (sr *StubRepository) ReplaceAtIndex(stub Stub, index int) error {
 		return util.NewValidationError("invalid stub index", index)
 	}
 	
+	if stub.ID == "" {
+		stub.ID = sr.stubs[index].ID
+	}
+	if err := sr.prepare(&stub, index); err != nil {
+		return err
+	}
 	sr.stubs[index] = stub
+	sr.index = nil
 	if sr.onUpdate != nil {
 		sr.onUpdate()
 	}
@@ -121,19 +287,309 @@ func (sr *StubRepository) ReplaceAll(stubs []Stub) error {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 	
+	if err := ValidateStubs(stubs, sr.encoding); err != nil {
+		return err
+	}
+	initStubs(stubs)
 	sr.stubs = stubs
+	sr.index = nil
 	if sr.onUpdate != nil {
 		sr.onUpdate()
 	}
 	return nil
 }
 
-// GetAll returns all stubs
+// GetAll returns a copy of all stubs
 func (sr *StubRepository) GetAll() []Stub {
 	sr.mu.RLock()
 	defer sr.mu.RUnlock()
 	
-	return sr.stubs
+	stubs := make([]Stub, len(sr.stubs))
+	copy(stubs, sr.stubs)
+	return stubs
+}
+
+// Get returns the stub with the given id and its current index
+func (sr *StubRepository) Get(id string) (Stub, int, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	index := sr.indexOf(id)
+	if index < 0 {
+		return Stub{}, -1, util.NewMissingResourceError("no stub with id "+id, id)
+	}
+	return sr.stubs[index], index, nil
+}
+
+// Has reports whether a stub with the given id exists
+func (sr *StubRepository) Has(id string) bool {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	return sr.indexOf(id) >= 0
+}
+
+// UpdateByID replaces the stub with the given id by the result of update,
+// keeping its id and position
+func (sr *StubRepository) UpdateByID(id string, update func(Stub) (Stub, error)) (Stub, error) {
+	var updated Stub
+	err := sr.change(func() (bool, error) {
+		index := sr.indexOf(id)
+		if index < 0 {
+			return false, util.NewMissingResourceError("no stub with id "+id, id)
+		}
+
+		stub, err := update(sr.stubs[index])
+		if err != nil {
+			return false, err
+		}
+		if stub.ID != "" && stub.ID != id {
+			return false, util.NewValidationError("stub id cannot be changed", stub.ID)
+		}
+		stub.ID = id
+		if err := sr.prepare(&stub, index); err != nil {
+			return false, err
+		}
+
+		sr.stubs[index] = stub
+		sr.index = nil
+		updated = stub
+		return true, nil
+	})
+	return updated, err
+}
+
+// DeleteByID deletes the stub with the given id
+func (sr *StubRepository) DeleteByID(id string) error {
+	return sr.change(func() (bool, error) {
+		index := sr.indexOf(id)
+		if index < 0 {
+			return false, util.NewMissingResourceError("no stub with id "+id, id)
+		}
+
+		sr.stubs = append(sr.stubs[:index], sr.stubs[index+1:]...)
+		sr.index = nil
+		return true, nil
+	})
+}
+
+// Move moves the stub with the given id to a new index, shifting the stubs
+// in between. The index is clamped to the ends of the list.
+func (sr *StubRepository) Move(id string, index int) error {
+	return sr.change(func() (bool, error) {
+		from := sr.indexOf(id)
+		if from < 0 {
+			return false, util.NewMissingResourceError("no stub with id "+id, id)
+		}
+		sr.moveTo(from, index)
+		return true, nil
+	})
+}
+
+// MoveNextTo moves the stub with the given id to just before, or with after
+// just after, the target stub. Both are found under the same lock as the
+// move, so concurrent changes cannot shift the target in between.
+func (sr *StubRepository) MoveNextTo(id, target string, after bool) error {
+	return sr.change(func() (bool, error) {
+		from := sr.indexOf(id)
+		if from < 0 {
+			return false, util.NewMissingResourceError("no stub with id "+id, id)
+		}
+		to := sr.indexOf(target)
+		if to < 0 {
+			return false, util.NewValidationError("no stub with id "+target, target)
+		}
+
+		// Removing the stub first shifts later targets down by one
+		if from < to {
+			to--
+		}
+		if after {
+			to++
+		}
+		sr.moveTo(from, to)
+		return true, nil
+	})
+}
+
+// moveTo moves the stub at from to index, clamped to the ends of the list;
+// callers hold the write lock
+func (sr *StubRepository) moveTo(from, index int) {
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sr.stubs) {
+		index = len(sr.stubs) - 1
+	}
+
+	stub := sr.stubs[from]
+	sr.stubs = append(sr.stubs[:from], sr.stubs[from+1:]...)
+	sr.stubs = append(sr.stubs[:index], append([]Stub{stub}, sr.stubs[index:]...)...)
+	sr.index = nil
+}
+
+// SetEnabled enables or disables the stubs selected by the filter, keeping
+// their position and match counts. It returns the number of stubs selected.
+func (sr *StubRepository) SetEnabled(filter func(*Stub) bool, enabled bool) int {
+	count := 0
+	sr.change(func() (bool, error) {
+		for i := range sr.stubs {
+			if filter(&sr.stubs[i]) {
+				value := enabled
+				sr.stubs[i].Enabled = &value
+				count++
+			}
+		}
+		return count > 0, nil
+	})
+	return count
+}
+
+// change runs fn under the write lock, then saves outside it if fn reports
+// a change, since saving reads the stubs
+func (sr *StubRepository) change(fn func() (bool, error)) error {
+	changed, err := func() (bool, error) {
+		sr.mu.Lock()
+		defer sr.mu.Unlock()
+		return fn()
+	}()
+
+	if changed && sr.onUpdate != nil {
+		sr.onUpdate()
+	}
+	return err
+}
+
+// indexOf returns the index of the stub with the given id, or -1
+func (sr *StubRepository) indexOf(id string) int {
+	for i := range sr.stubs {
+		if sr.stubs[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// prepare assigns an id to a stub about to be stored at index (-1 for a
+// new stub), rejecting ids already used by another stub. A new stub starts
+// its expiry afresh; a replaced stub keeps its match count and age unless
+// its expiry settings changed.
+func (sr *StubRepository) prepare(stub *Stub, index int) error {
+	if err := validateStub(stub, sr.encoding); err != nil {
+		return err
+	}
+	if index >= 0 && sameExpiry(&sr.stubs[index], stub) {
+		stub.matchCount = sr.stubs[index].matchCount
+		stub.addedAt = sr.stubs[index].addedAt
+	} else {
+		stub.matchCount = 0
+		stub.addedAt = time.Now()
+	}
+
+	if stub.ID == "" {
+		stub.ID = newStubID()
+		return nil
+	}
+	if existing := sr.indexOf(stub.ID); existing >= 0 && existing != index {
+		return util.NewValidationError("duplicate stub id "+stub.ID, stub.ID)
+	}
+	return nil
+}
+
+// sameExpiry reports whether two stubs have the same expiry settings
+func sameExpiry(a, b *Stub) bool {
+	sameInt := func(x, y *int) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && *x == *y)
+	}
+	return sameInt(a.ExpiresAfterMatches, b.ExpiresAfterMatches) && sameInt(a.TTLSeconds, b.TTLSeconds)
+}
+
+// ValidateStubs checks stubs before they are stored, compiling their
+// predicates for the imposter encoding
+func ValidateStubs(stubs []Stub, encoding string) error {
+	seen := make(map[string]bool)
+	for i := range stubs {
+		if err := validateStub(&stubs[i], encoding); err != nil {
+			return err
+		}
+		if stubs[i].ID == "" {
+			continue
+		}
+		if seen[stubs[i].ID] {
+			return util.NewValidationError("duplicate stub id "+stubs[i].ID, stubs[i].ID)
+		}
+		seen[stubs[i].ID] = true
+	}
+	return nil
+}
+
+// validateStub checks the fields of a single stub and compiles its
+// predicates
+func validateStub(stub *Stub, encoding string) error {
+	if stub.ExpiresAfterMatches != nil && *stub.ExpiresAfterMatches < 1 {
+		return util.NewValidationError("expiresAfterMatches must be at least 1", *stub.ExpiresAfterMatches)
+	}
+	if stub.TTLSeconds != nil && *stub.TTLSeconds < 1 {
+		return util.NewValidationError("ttlSeconds must be at least 1", *stub.TTLSeconds)
+	}
+
+	for _, response := range stub.Responses {
+		for _, behavior := range response.Behaviors {
+			// Stubs kept through an update share their compiled waits
+			// and fakers
+			if behavior.Wait != nil && !behavior.Wait.compiled {
+				if err := behavior.Wait.compile(); err != nil {
+					return err
+				}
+			}
+			if behavior.Faker != nil && !behavior.Faker.compiled {
+				if err := behavior.Faker.compile(); err != nil {
+					return err
+				}
+			}
+			if behavior.Throttle != nil {
+				if err := behavior.Throttle.validate(); err != nil {
+					return err
+				}
+			}
+		}
+		if response.Is == nil {
+			continue
+		}
+		for _, cookie := range response.Is.Cookies {
+			if _, err := cookie.HTTPCookie(); err != nil {
+				return util.NewValidationError(err.Error(), cookie)
+			}
+		}
+	}
+
+	matchers, err := compilePredicates(stub.Predicates, encoding)
+	if err != nil {
+		return err
+	}
+	stub.matchers = matchers
+	return nil
+}
+
+// initStubs generates ids for stubs that lack one and starts their expiry
+func initStubs(stubs []Stub) {
+	now := time.Now()
+	for i := range stubs {
+		if stubs[i].ID == "" {
+			stubs[i].ID = newStubID()
+		}
+		stubs[i].matchCount = 0
+		stubs[i].addedAt = now
+	}
+}
+
+// newStubID generates a random stub id
+func newStubID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("unable to generate stub id: %v", err))
+	}
+	return "stub-" + hex.EncodeToString(b)
 }
 
 // AddRequest records a request
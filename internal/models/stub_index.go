@@ -0,0 +1,181 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// stubIndex narrows the stubs that can match a request using the method and
+// path values of their equals and startsWith predicates. It only rules out
+// stubs that cannot match; candidates are still evaluated in order against
+// all of their predicates, so first-match semantics are unchanged.
+type stubIndex struct {
+	exact    map[indexKey][]int
+	prefixes map[indexKey][]int
+
+	// unindexed holds the stubs without a usable method or path predicate
+	unindexed []int
+
+	// expiresAt is when the first stub with a ttlSeconds expires, and zero
+	// when no stub has one
+	expiresAt time.Time
+}
+
+// indexKey is a normalized method or path value
+type indexKey struct {
+	field         string
+	caseSensitive bool
+	value         string
+}
+
+// indexedFields are the request fields the index knows about, in order of
+// preference
+var indexedFields = []string{"path", "method"}
+
+// newStubIndex indexes each stub under its most selective method or path
+// predicate
+func newStubIndex(stubs []Stub) *stubIndex {
+	idx := &stubIndex{
+		exact:    make(map[indexKey][]int),
+		prefixes: make(map[indexKey][]int),
+	}
+
+	for i := range stubs {
+		if ttl := stubs[i].TTLSeconds; ttl != nil {
+			expiresAt := stubs[i].addedAt.Add(time.Duration(*ttl) * time.Second)
+			if idx.expiresAt.IsZero() || expiresAt.Before(idx.expiresAt) {
+				idx.expiresAt = expiresAt
+			}
+		}
+
+		key, prefix, ok := indexKeyFor(&stubs[i])
+		switch {
+		case !ok:
+			idx.unindexed = append(idx.unindexed, i)
+		case prefix:
+			idx.prefixes[key] = append(idx.prefixes[key], i)
+		default:
+			idx.exact[key] = append(idx.exact[key], i)
+		}
+	}
+	return idx
+}
+
+// expired reports whether any stub may have outlived its ttlSeconds
+func (idx *stubIndex) expired(now time.Time) bool {
+	return !idx.expiresAt.IsZero() && !now.Before(idx.expiresAt)
+}
+
+// candidates returns the indexes of the stubs that may match the request,
+// in stub order
+func (idx *stubIndex) candidates(request *Request) []int {
+	result := append([]int(nil), idx.unindexed...)
+
+	for _, field := range indexedFields {
+		value := request.Method
+		if field == "path" {
+			value = request.Path
+		}
+		// Predicates on a missing field never match
+		if value == "" {
+			continue
+		}
+
+		for _, caseSensitive := range []bool{false, true} {
+			key := indexKey{field: field, caseSensitive: caseSensitive, value: value}
+			if !caseSensitive {
+				key.value = strings.ToLower(value)
+			}
+			result = append(result, idx.exact[key]...)
+
+			normalized := key.value
+			for end := 0; end <= len(normalized); end++ {
+				key.value = normalized[:end]
+				result = append(result, idx.prefixes[key]...)
+			}
+		}
+	}
+
+	// Each stub is indexed once, so sorting restores stub order
+	sort.Ints(result)
+	return result
+}
+
+// indexKeyFor picks the predicate the stub is indexed under, preferring
+// exact paths, then path prefixes, then methods. Only predicates with a
+// single equals or startsWith operator and no selectors or except pattern
+// pin a field, since anything else may match other values.
+func indexKeyFor(stub *Stub) (indexKey, bool, bool) {
+	var best indexKey
+	bestPrefix, found := false, false
+	bestRank := len(indexedFields) * 2
+
+	for i := range stub.Predicates {
+		predicate := &stub.Predicates[i]
+		expected, prefix, ok := indexableOperator(predicate)
+		if !ok {
+			continue
+		}
+		caseSensitive := predicate.CaseSensitive != nil && *predicate.CaseSensitive
+
+		for rank, field := range indexedFields {
+			value, ok := indexedValue(expected, field, caseSensitive)
+			if !ok {
+				continue
+			}
+
+			rank = rank * 2
+			if prefix {
+				rank++
+			}
+			if rank < bestRank {
+				best = indexKey{field: field, caseSensitive: caseSensitive, value: value}
+				bestPrefix, bestRank, found = prefix, rank, true
+			}
+		}
+	}
+	return best, bestPrefix, found
+}
+
+// indexableOperator returns the fields of a predicate that has nothing but
+// an equals or startsWith operator, and whether it is startsWith
+func indexableOperator(p *Predicate) (map[string]interface{}, bool, bool) {
+	if p.DeepEquals != nil || p.Contains != nil || p.EndsWith != nil || p.Matches != nil ||
+		p.Exists != nil || p.Not != nil || p.Or != nil || p.And != nil || p.Inject != "" ||
+		p.Except != "" || p.XPath != nil || p.JSONPath != nil {
+		return nil, false, false
+	}
+
+	switch {
+	case p.Equals != nil && p.StartsWith == nil:
+		fields, ok := p.Equals.(map[string]interface{})
+		return fields, false, ok
+	case p.StartsWith != nil && p.Equals == nil:
+		fields, ok := p.StartsWith.(map[string]interface{})
+		return fields, true, ok
+	}
+	return nil, false, false
+}
+
+// indexedValue returns the normalized string expected for a field, matching
+// keys the way predicate evaluation does
+func indexedValue(fields map[string]interface{}, field string, caseSensitive bool) (string, bool) {
+	var value interface{}
+	matches := 0
+	for key, v := range fields {
+		if key == field || (!caseSensitive && strings.ToLower(key) == field) {
+			value = v
+			matches++
+		}
+	}
+
+	s, ok := value.(string)
+	if matches != 1 || !ok {
+		return "", false
+	}
+	if !caseSensitive {
+		s = strings.ToLower(s)
+	}
+	return s, true
+}
@@ -0,0 +1,410 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/oliveagle/jsonpath"
+)
+
+// maxCachedTemplates bounds how many parsed templates an executor keeps
+const maxCachedTemplates = 256
+
+// maxTemplateLength caps the lengths seq and randomString accept, as they
+// may be taken from the request
+const maxTemplateLength = 10000
+
+// cachedTemplate is a parsed template in the least recently used order
+type cachedTemplate struct {
+	key  string
+	tmpl *template.Template
+}
+
+// executeTemplate renders the response body and headers as templates
+func (be *BehaviorExecutor) executeTemplate(request *Request, response *Response, options *TemplateBehavior) (*Response, error) {
+	state, globalState := be.state.snapshot()
+	data := map[string]interface{}{
+		"request":     be.templateRequest(request),
+		"state":       state,
+		"globalState": globalState,
+	}
+
+	// Copy so the stub's configured response is left untouched
+	rendered := *response
+
+	body, err := be.renderValue(response.Body, data, options)
+	if err != nil {
+		return nil, err
+	}
+	rendered.Body = body
+
+	if response.Headers != nil {
+		rendered.Headers = make(map[string]interface{}, len(response.Headers))
+		for name, value := range response.Headers {
+			if rendered.Headers[name], err = be.renderValue(value, data, options); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &rendered, nil
+}
+
+// templateRequest exposes the request to templates, adding the parsed body
+// as json when the body is a JSON document, whatever its content type
+func (be *BehaviorExecutor) templateRequest(request *Request) map[string]interface{} {
+	result := be.requestToMap(request)
+	switch body := request.Body.(type) {
+	case nil:
+	case string:
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(body), &parsed); err == nil {
+			result["json"] = parsed
+		}
+	default:
+		result["json"] = result["body"]
+	}
+	return result
+}
+
+// renderValue renders every string within a body or header value
+func (be *BehaviorExecutor) renderValue(value interface{}, data map[string]interface{}, options *TemplateBehavior) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return be.renderString(v, data, options)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := be.renderValue(item, data, options)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = rendered
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := be.renderValue(item, data, options)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = rendered
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// renderString renders a single template, caching the parsed form
+func (be *BehaviorExecutor) renderString(text string, data map[string]interface{}, options *TemplateBehavior) (string, error) {
+	left, right := options.LeftDelim, options.RightDelim
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+	if !strings.Contains(text, left) {
+		return text, nil
+	}
+
+	tmpl, err := be.parseTemplate(text, left, right)
+	if err != nil {
+		return "", fmt.Errorf("template rendering failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("template rendering failed: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// parseTemplate returns the parsed template for text, parsing it on first
+// use. Text changed by earlier behaviors differs between requests, so only
+// the most recently used templates are kept.
+func (be *BehaviorExecutor) parseTemplate(text, left, right string) (*template.Template, error) {
+	key := left + "\x00" + right + "\x00" + text
+
+	be.templateMu.Lock()
+	if element, ok := be.templates[key]; ok {
+		be.templateOrder.MoveToFront(element)
+		be.templateMu.Unlock()
+		return element.Value.(*cachedTemplate).tmpl, nil
+	}
+	be.templateMu.Unlock()
+
+	parsed, err := template.New("response").Delims(left, right).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range parsed.Templates() {
+		printMissingAsEmpty(t.Tree.Root)
+	}
+
+	be.templateMu.Lock()
+	defer be.templateMu.Unlock()
+	if element, ok := be.templates[key]; ok {
+		be.templateOrder.MoveToFront(element)
+		return element.Value.(*cachedTemplate).tmpl, nil
+	}
+	be.templates[key] = be.templateOrder.PushFront(&cachedTemplate{key: key, tmpl: parsed})
+	if be.templateOrder.Len() > maxCachedTemplates {
+		oldest := be.templateOrder.Back()
+		be.templateOrder.Remove(oldest)
+		delete(be.templates, oldest.Value.(*cachedTemplate).key)
+	}
+	return parsed, nil
+}
+
+// printMissingAsEmpty ends every printing action with orEmpty, so that
+// missing request fields render as empty text rather than as the
+// "<no value>" placeholder text/template prints for them
+func printMissingAsEmpty(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			printMissingAsEmpty(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			orEmpty := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos}
+			orEmpty.Args = []parse.Node{parse.NewIdentifier("orEmpty").SetPos(n.Pos)}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, orEmpty)
+		}
+	case *parse.IfNode:
+		printMissingAsEmpty(n.List)
+		printMissingAsEmpty(n.ElseList)
+	case *parse.RangeNode:
+		printMissingAsEmpty(n.List)
+		printMissingAsEmpty(n.ElseList)
+	case *parse.WithNode:
+		printMissingAsEmpty(n.List)
+		printMissingAsEmpty(n.ElseList)
+	}
+}
+
+// templateOrEmpty prints nothing for missing values
+func templateOrEmpty(value interface{}) interface{} {
+	if value == nil {
+		return ""
+	}
+	return value
+}
+
+// templateFuncs are the helpers available to response templates
+var templateFuncs = template.FuncMap{
+	"now":          func() time.Time { return time.Now().UTC() },
+	"date":         templateDate,
+	"uuid":         templateUUID,
+	"randomInt":    templateRandomInt,
+	"randomString": templateRandomString,
+	"base64":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"base64Decode": templateBase64Decode,
+	"json":         templateJSON,
+	"parseJSON":    templateParseJSON,
+	"jsonPath":     templateJSONPath,
+	"xpath":        templateXPath,
+	"default":      templateDefault,
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"add":          func(a, b interface{}) float64 { return toFloat(a) + toFloat(b) },
+	"seq":          templateSeq,
+	"fake":         func(kind string) (string, error) { return defaultFaker.Generate(kind, nil) },
+	"orEmpty":      templateOrEmpty,
+}
+
+// dateLayouts names the common layouts accepted by the date helper
+var dateLayouts = map[string]string{
+	"":        time.RFC3339,
+	"RFC3339": time.RFC3339,
+	"RFC1123": http1123,
+	"ISO8601": "2006-01-02T15:04:05.000Z07:00",
+}
+
+// http1123 is the date format used in HTTP headers
+const http1123 = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// templateDate formats the current UTC time, optionally shifted by a
+// duration such as "-24h". The layout is a Go layout, a name from
+// dateLayouts, unix or unixMillis.
+func templateDate(layout string, offset ...string) (string, error) {
+	now := time.Now().UTC()
+	if len(offset) > 0 {
+		shift, err := time.ParseDuration(offset[0])
+		if err != nil {
+			return "", err
+		}
+		now = now.Add(shift)
+	}
+
+	switch layout {
+	case "unix":
+		return strconv.FormatInt(now.Unix(), 10), nil
+	case "unixMillis":
+		return strconv.FormatInt(now.UnixMilli(), 10), nil
+	}
+	if named, ok := dateLayouts[layout]; ok {
+		layout = named
+	}
+	return now.Format(layout), nil
+}
+
+// templateUUID returns a random version 4 UUID
+func templateUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// templateRandomInt returns a random integer between min and max inclusive
+func templateRandomInt(min, max interface{}) (int64, error) {
+	lo, hi := int64(toFloat(min)), int64(toFloat(max))
+	if hi < lo {
+		return 0, fmt.Errorf("randomInt max must not be less than min")
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(hi-lo+1))
+	if err != nil {
+		return 0, err
+	}
+	return lo + n.Int64(), nil
+}
+
+// templateRandomString returns a random alphanumeric string
+func templateRandomString(length interface{}) (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	n, err := templateLength(length)
+	if err != nil {
+		return "", err
+	}
+
+	result := make([]byte, n)
+	for i := range result {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		result[i] = alphabet[index.Int64()]
+	}
+	return string(result), nil
+}
+
+func templateBase64Decode(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	return string(data), err
+}
+
+func templateJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+func templateParseJSON(s string) (interface{}, error) {
+	var value interface{}
+	err := json.Unmarshal([]byte(s), &value)
+	return value, err
+}
+
+// templateJSONPath selects from a parsed value or a JSON string
+func templateJSONPath(value interface{}, path string) (interface{}, error) {
+	if s, ok := value.(string); ok {
+		parsed, err := templateParseJSON(s)
+		if err != nil {
+			return nil, err
+		}
+		value = parsed
+	}
+
+	result, err := jsonpath.JsonPathLookup(value, path)
+	if err != nil {
+		// A path that does not match renders as empty
+		return "", nil
+	}
+	return result, nil
+}
+
+// templateXPath returns the text of the first node matching the path
+func templateXPath(xml string, path string) (string, error) {
+	doc, err := xmlquery.Parse(strings.NewReader(xml))
+	if err != nil {
+		return "", err
+	}
+	node, err := xmlquery.Query(doc, path)
+	if err != nil {
+		return "", err
+	}
+	if node == nil {
+		return "", nil
+	}
+	return node.InnerText(), nil
+}
+
+// templateDefault returns value, or fallback when value is empty
+func templateDefault(fallback, value interface{}) interface{} {
+	if value == nil || value == "" {
+		return fallback
+	}
+	return value
+}
+
+// templateSeq returns the integers from 0 up to n for use with range
+func templateSeq(n interface{}) ([]int, error) {
+	count, err := templateLength(n)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]int, count)
+	for i := range result {
+		result[i] = i
+	}
+	return result, nil
+}
+
+// templateLength converts a length given to seq or randomString, which may
+// come from the request, rejecting lengths above maxTemplateLength
+func templateLength(value interface{}) (int, error) {
+	n := toFloat(value)
+	if n > maxTemplateLength {
+		return 0, fmt.Errorf("length %v exceeds the limit of %d", value, maxTemplateLength)
+	}
+	if !(n >= 0) {
+		return 0, nil
+	}
+	return int(n), nil
+}
+
+// toFloat converts template numbers, which may be Go or JSON numbers or
+// numeric strings, to float64
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
@@ -2,6 +2,14 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/util"
 )
 
 // Request represents a protocol-agnostic request
@@ -16,8 +24,19 @@ type Request struct {
 	Path    string                 `json:"path"`
 	Query   map[string]interface{} `json:"query"`
 	Headers map[string]interface{} `json:"headers"`
+	Cookies map[string]interface{} `json:"cookies,omitempty"`
 	Body    interface{}            `json:"body"`
 
+	// RawHeaders lists header names and values alternately, in the order
+	// and case they were received
+	RawHeaders []string `json:"rawHeaders,omitempty"`
+
+	// Host is the upstream target of a forward proxy request
+	Host string `json:"host,omitempty"`
+
+	// ServerName is the TLS server name (SNI) sent by the client
+	ServerName string `json:"serverName,omitempty"`
+
 	// TCP-specific fields
 	Data string `json:"data,omitempty"`
 
@@ -37,8 +56,16 @@ type Response struct {
 	// HTTP-specific fields
 	StatusCode int                    `json:"statusCode,omitempty"`
 	Headers    map[string]interface{} `json:"headers,omitempty"`
+	Cookies    ResponseCookieList     `json:"cookies,omitempty"`
 	Body       interface{}            `json:"body,omitempty"`
 
+	// BodyFile serves the body from a file, relative to the body root
+	BodyFile string `json:"bodyFile,omitempty"`
+
+	// Compression selects the Content-Encoding for the body: gzip, deflate, br,
+	// auto (negotiate with Accept-Encoding) or none
+	Compression string `json:"compression,omitempty"`
+
 	// TCP-specific fields
 	Data string `json:"data,omitempty"`
 
@@ -50,9 +77,117 @@ type Response struct {
 	CallbackURL string      `json:"callbackURL,omitempty"`
 
 	// Internal fields
-	ProxyResponseTime int    `json:"_proxyResponseTime,omitempty"`
-	Blocked           bool   `json:"blocked,omitempty"`
-	Code              string `json:"code,omitempty"`
+	ProxyResponseTime int               `json:"_proxyResponseTime,omitempty"`
+	Blocked           bool              `json:"blocked,omitempty"`
+	Code              string            `json:"code,omitempty"`
+	Throttle          *ThrottleBehavior `json:"-"`
+
+	// AfterSend is called by the protocol once the response has been written
+	AfterSend func() `json:"-"`
+}
+
+// ResponseCookie represents a cookie set by a response
+type ResponseCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	MaxAge   int    `json:"maxAge,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	SameSite string `json:"sameSite,omitempty"`
+}
+
+// HTTPCookie converts the cookie into a net/http cookie, rejecting an
+// unknown sameSite or an unparseable expires
+func (c ResponseCookie) HTTPCookie() (*http.Cookie, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("cookie name is required")
+	}
+
+	httpCookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		MaxAge:   c.MaxAge,
+		HttpOnly: c.HTTPOnly,
+		Secure:   c.Secure,
+	}
+
+	if c.Expires != "" {
+		expires, err := parseCookieTime(c.Expires)
+		if err != nil {
+			return nil, err
+		}
+		httpCookie.Expires = expires
+	}
+
+	switch strings.ToLower(c.SameSite) {
+	case "":
+	case "strict":
+		httpCookie.SameSite = http.SameSiteStrictMode
+	case "lax":
+		httpCookie.SameSite = http.SameSiteLaxMode
+	case "none":
+		httpCookie.SameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("invalid sameSite value %q for cookie %s", c.SameSite, c.Name)
+	}
+
+	return httpCookie, nil
+}
+
+// parseCookieTime accepts either HTTP dates or ISO 8601 timestamps
+func parseCookieTime(value string) (time.Time, error) {
+	if t, err := http.ParseTime(value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid cookie expires value: %s", value)
+}
+
+// ResponseCookieList represents a list of response cookies
+type ResponseCookieList []ResponseCookie
+
+// UnmarshalJSON implements custom unmarshaling for ResponseCookieList
+func (l *ResponseCookieList) UnmarshalJSON(data []byte) error {
+	// Try array
+	var list []ResponseCookie
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = ResponseCookieList(list)
+		return nil
+	}
+
+	// Try object keyed by cookie name, with either a value or attributes
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(data, &named); err != nil {
+		return err
+	}
+
+	result := make(ResponseCookieList, 0, len(named))
+	for name, raw := range named {
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			result = append(result, ResponseCookie{Name: name, Value: value})
+			continue
+		}
+
+		var cookie ResponseCookie
+		if err := json.Unmarshal(raw, &cookie); err != nil {
+			return err
+		}
+		cookie.Name = name
+		result = append(result, cookie)
+	}
+
+	// Map iteration order is random, keep Set-Cookie output stable
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	*l = result
+	return nil
 }
 
 // Predicate represents a request matching condition
@@ -88,17 +223,34 @@ type JSONPathConfig struct {
 
 // Behavior represents a response transformation
 type Behavior struct {
-	Wait           *WaitBehavior    `json:"wait,omitempty"`
-	Decorate       string           `json:"decorate,omitempty"`
-	Copy           CopyBehaviorList `json:"copy,omitempty"`
-	Lookup         *LookupBehavior  `json:"lookup,omitempty"`
-	ShellTransform string           `json:"shellTransform,omitempty"`
+	Wait           *WaitBehavior     `json:"wait,omitempty"`
+	Decorate       string            `json:"decorate,omitempty"`
+	Copy           CopyBehaviorList  `json:"copy,omitempty"`
+	Lookup         *LookupBehavior   `json:"lookup,omitempty"`
+	ShellTransform string            `json:"shellTransform,omitempty"`
+	Throttle       *ThrottleBehavior `json:"throttle,omitempty"`
+	Template       *TemplateBehavior `json:"template,omitempty"`
+	Faker          *FakerBehavior    `json:"faker,omitempty"`
+	Callback       CallbackList      `json:"callback,omitempty"`
 }
 
-// WaitBehavior represents a wait/latency behavior
+// WaitBehavior represents a wait/latency behavior. The latency is either a
+// fixed number of milliseconds, the result of a JavaScript function, or a
+// sample from one of the distributions.
 type WaitBehavior struct {
 	Milliseconds int    `json:"milliseconds,omitempty"`
 	Fn           string `json:"fn,omitempty"` // For JS injection
+
+	Uniform     *UniformDistribution   `json:"uniform,omitempty"`
+	Normal      *NormalDistribution    `json:"normal,omitempty"`
+	LogNormal   *LogNormalDistribution `json:"lognormal,omitempty"`
+	Percentiles map[string]float64     `json:"percentiles,omitempty"`
+	Seed        *int64                 `json:"seed,omitempty"`
+
+	// Prepared when the stub is added
+	compiled bool
+	points   []percentilePoint
+	seeded   *rand.Rand
 }
 
 // UnmarshalJSON implements custom unmarshaling for WaitBehavior
@@ -127,6 +279,110 @@ func (w *WaitBehavior) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// ThrottleBehavior slows down writing the response body. Headers are sent
+// immediately; the body then trickles in at bytesPerSecond, or in chunks of
+// chunkSize bytes separated by chunkDelay milliseconds. stallAfter stops
+// writing after that many bytes and holds the connection open.
+type ThrottleBehavior struct {
+	BytesPerSecond *int `json:"bytesPerSecond,omitempty"`
+	ChunkSize      *int `json:"chunkSize,omitempty"`
+	ChunkDelay     int  `json:"chunkDelay,omitempty"`
+	FirstByteDelay int  `json:"firstByteDelay,omitempty"`
+	StallAfter     *int `json:"stallAfter,omitempty"`
+}
+
+// TemplateBehavior renders the response body and headers as Go templates
+// against the request and imposter state. It is enabled with
+// "template": true, or with an object choosing other delimiters for bodies
+// that already contain "{{".
+type TemplateBehavior struct {
+	LeftDelim  string `json:"leftDelim,omitempty"`
+	RightDelim string `json:"rightDelim,omitempty"`
+
+	disabled bool
+}
+
+// UnmarshalJSON implements custom unmarshaling for TemplateBehavior
+func (t *TemplateBehavior) UnmarshalJSON(data []byte) error {
+	// Try boolean
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*t = TemplateBehavior{disabled: !enabled}
+		return nil
+	}
+
+	// Try object
+	type Alias TemplateBehavior
+	var aux Alias
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*t = TemplateBehavior(aux)
+	return nil
+}
+
+// MarshalJSON writes the behavior back in the form it was given, so that a
+// disabled template stays disabled when the stub is saved or reloaded
+func (t TemplateBehavior) MarshalJSON() ([]byte, error) {
+	if t.disabled {
+		return []byte("false"), nil
+	}
+	if t.LeftDelim == "" && t.RightDelim == "" {
+		return []byte("true"), nil
+	}
+
+	type Alias TemplateBehavior
+	return json.Marshal(Alias(t))
+}
+
+// FakerBehavior replaces each token in the response with generated data.
+// Into maps tokens to a generator name such as "email", or to an object
+// with a type and generator options. A seed makes the sequence of values
+// reproducible.
+type FakerBehavior struct {
+	Seed *int64                 `json:"seed,omitempty"`
+	Into map[string]interface{} `json:"into"`
+
+	// Prepared when the stub is added
+	compiled bool
+	seeded   *Faker
+}
+
+// CallbackList represents a list of callbacks
+type CallbackList []CallbackBehavior
+
+// UnmarshalJSON implements custom unmarshaling for CallbackList
+func (l *CallbackList) UnmarshalJSON(data []byte) error {
+	// Try object (single item)
+	var single CallbackBehavior
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = CallbackList{single}
+		return nil
+	}
+
+	// Try array
+	var list []CallbackBehavior
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = CallbackList(list)
+	return nil
+}
+
+// CallbackBehavior sends an HTTP request once the response has been sent.
+// The URL, headers and body are templates over the request, response and
+// state. Failed attempts, including 5xx responses, are retried up to
+// Retries times, RetryDelay milliseconds apart.
+type CallbackBehavior struct {
+	Method     string            `json:"method,omitempty"`
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       interface{}       `json:"body,omitempty"`
+	Delay      int               `json:"delay,omitempty"`
+	Retries    int               `json:"retries,omitempty"`
+	RetryDelay int               `json:"retryDelay,omitempty"`
+}
+
 // CopyBehaviorList represents a list of copy behaviors
 type CopyBehaviorList []CopyBehavior
 
@@ -214,6 +470,42 @@ type ProxyConfig struct {
 	AddDecorateBehavior string               `json:"addDecorateBehavior,omitempty"`
 }
 
+// ForwardProxyConfig represents forward proxy configuration. CONNECT tunnels
+// are passed through to the target unless TLS interception is enabled, in
+// which case requests are decrypted with a certificate minted from the CA
+// and matched against the stubs.
+type ForwardProxyConfig struct {
+	InterceptTLS bool   `json:"interceptTLS,omitempty"`
+	CACert       string `json:"caCert,omitempty"`
+	CAKey        string `json:"caKey,omitempty"`
+}
+
+// VirtualHost represents the stubs served for one host name of an imposter.
+// Host may be a wildcard such as *.example.com. Requests for hosts without a
+// virtual host fall back to the imposter's own stubs.
+type VirtualHost struct {
+	Host            string    `json:"host"`
+	Stubs           []Stub    `json:"stubs,omitempty"`
+	DefaultResponse *Response `json:"defaultResponse,omitempty"`
+
+	// HTTPS-specific
+	Key  string `json:"key,omitempty"`
+	Cert string `json:"cert,omitempty"`
+}
+
+// TLSOptions represents the TLS settings of an HTTPS imposter. Versions are
+// given as 1.0 to 1.3, cipher suites and curves by their Go names (e.g.
+// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, X25519). Cipher suites only
+// apply to TLS 1.2 and earlier.
+type TLSOptions struct {
+	MinVersion     string   `json:"minVersion,omitempty"`
+	MaxVersion     string   `json:"maxVersion,omitempty"`
+	CipherSuites   []string `json:"cipherSuites,omitempty"`
+	Curves         []string `json:"curves,omitempty"`
+	ALPN           []string `json:"alpn,omitempty"`
+	SessionTickets *bool    `json:"sessionTickets,omitempty"`
+}
+
 // FaultConfig represents fault injection configuration
 type FaultConfig struct {
 	Fault string `json:"fault"`
@@ -230,13 +522,52 @@ type Match struct {
 
 // Stub represents a stub with predicates and responses
 type Stub struct {
+	// ID identifies the stub independently of its position. It is generated
+	// when not supplied.
+	ID string `json:"id,omitempty"`
+
 	Predicates []Predicate      `json:"predicates,omitempty"`
 	Responses  []ResponseConfig `json:"responses"`
 	Matches    []Match          `json:"matches,omitempty"`
 	Links      *StubLinks       `json:"_links,omitempty"`
 
+	// Scenario makes the stub part of a named state machine. The stub only
+	// matches while the scenario is in State, if given, and moves the
+	// scenario to NewState as it matches.
+	Scenario string `json:"scenario,omitempty"`
+	State    string `json:"state,omitempty"`
+	NewState string `json:"newState,omitempty"`
+
+	// ExpiresAfterMatches removes the stub once it has matched this many
+	// requests. TTLSeconds removes it this many seconds after it was added.
+	ExpiresAfterMatches *int `json:"expiresAfterMatches,omitempty"`
+	TTLSeconds          *int `json:"ttlSeconds,omitempty"`
+
+	// Enabled set to false keeps the stub in place without matching it.
+	// Tags group stubs so they can be enabled or disabled together.
+	Enabled *bool    `json:"enabled,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+
 	// Internal
-	IsProxy bool `json:"-"`
+	IsProxy    bool `json:"-"`
+	matchCount int
+	addedAt    time.Time
+	matchers   []*predicateMatcher
+}
+
+// IsEnabled reports whether the stub takes part in matching
+func (s *Stub) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// HasTag reports whether the stub carries the tag
+func (s *Stub) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 // StubLinks contains hypermedia links for a stub
@@ -256,14 +587,79 @@ type ImposterConfig struct {
 	Middleware      string     `json:"middleware,omitempty"`
 	Requests        []*Request `json:"requests,omitempty"`
 
-	// HTTP-specific
+	// HTTP-specific. Key, Cert and CA take inline PEM or a path to a PEM file;
+	// without them, certificates are minted from the local CA.
 	Key        string `json:"key,omitempty"`
 	Cert       string `json:"cert,omitempty"`
+	CA         string `json:"ca,omitempty"`
 	MutualAuth bool   `json:"mutualAuth,omitempty"`
 
+	// CompressResponses negotiates response compression with Accept-Encoding
+	CompressResponses bool `json:"compressResponses,omitempty"`
+
+	// ForwardProxy lets an HTTP imposter act as an explicit proxy
+	ForwardProxy *ForwardProxyConfig `json:"forwardProxy,omitempty"`
+
+	// VirtualHosts partition stubs by Host header or TLS server name
+	VirtualHosts []VirtualHost `json:"virtualHosts,omitempty"`
+
+	// TLS configures the handshake of HTTPS imposters
+	TLS *TLSOptions `json:"tls,omitempty"`
+
+	// InjectionTimeout overrides the server's limit, in milliseconds, on how
+	// long an injected script may run
+	InjectionTimeout *int `json:"injectionTimeout,omitempty"`
+
 	// TCP-specific
 	Mode string `json:"mode,omitempty"`
 
 	// Common
 	Host string `json:"host,omitempty"`
+
+	// BodyRoot is the directory bodyFile paths are resolved against, set by
+	// the server rather than the imposter definition
+	BodyRoot string `json:"-"`
+
+	// DefaultInjectionTimeout is the server's script limit in milliseconds,
+	// used unless InjectionTimeout is set
+	DefaultInjectionTimeout int `json:"-"`
+
+	// ModulesDir is the directory scripts can require modules from, set by
+	// the server
+	ModulesDir string `json:"-"`
+
+	// StateStore holds the state scripts share, set by the server; without
+	// it the imposter keeps state to itself
+	StateStore *StateStore `json:"-"`
+}
+
+// Encoding returns the encoding predicates and responses use: base64 for
+// binary mode imposters, utf8 otherwise
+func (c *ImposterConfig) Encoding() string {
+	if c.Mode == "binary" {
+		return "base64"
+	}
+	return "utf8"
+}
+
+// Validate checks the imposter's settings and stubs
+func (c *ImposterConfig) Validate() error {
+	if c.InjectionTimeout != nil && *c.InjectionTimeout < 0 {
+		return util.NewValidationError("injectionTimeout must not be negative", *c.InjectionTimeout)
+	}
+	return c.ValidateStubs()
+}
+
+// ValidateStubs checks the imposter's stubs, including those of its virtual
+// hosts, compiling their predicates for the imposter encoding
+func (c *ImposterConfig) ValidateStubs() error {
+	if err := ValidateStubs(c.Stubs, c.Encoding()); err != nil {
+		return err
+	}
+	for _, vh := range c.VirtualHosts {
+		if err := ValidateStubs(vh.Stubs, c.Encoding()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
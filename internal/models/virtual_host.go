@@ -0,0 +1,81 @@
+package models
+
+import (
+	"net"
+	"strings"
+)
+
+// virtualHost holds the stubs for one host name of an imposter
+type virtualHost struct {
+	host            string
+	stubs           *StubRepository
+	defaultResponse *Response
+	key             string
+	cert            string
+}
+
+// NormalizeHost lowercases a host name and strips any port
+func NormalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+}
+
+// HostMatches reports whether a host name matches a virtual host pattern.
+// Patterns are exact names or wildcards such as *.example.com, which match
+// any subdomain but not example.com itself.
+func HostMatches(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	host = NormalizeHost(host)
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
+
+// FindVirtualHost returns the index of the pattern serving a host name,
+// preferring exact names over wildcards, or -1 if none does
+func FindVirtualHost(patterns []string, host string) int {
+	wildcard := -1
+	for i, pattern := range patterns {
+		if !HostMatches(pattern, host) {
+			continue
+		}
+		if !strings.HasPrefix(pattern, "*.") {
+			return i
+		}
+		if wildcard < 0 {
+			wildcard = i
+		}
+	}
+	return wildcard
+}
+
+// requestHost returns the host name a request was addressed to: the TLS
+// server name, the forward proxy target, or the Host header
+func requestHost(request *Request) string {
+	if request.ServerName != "" {
+		return request.ServerName
+	}
+	if request.Host != "" {
+		return request.Host
+	}
+	for name, value := range request.Headers {
+		if !strings.EqualFold(name, "Host") {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			return v
+		case []interface{}:
+			if len(v) > 0 {
+				if s, ok := v[0].(string); ok {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
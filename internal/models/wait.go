@@ -0,0 +1,144 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// UniformDistribution samples latency uniformly between min and max
+type UniformDistribution struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// NormalDistribution samples latency from a normal distribution
+type NormalDistribution struct {
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stdDev"`
+}
+
+// LogNormalDistribution samples latency whose logarithm is normally
+// distributed with mean mu and standard deviation sigma, giving the long
+// tail typical of real services
+type LogNormalDistribution struct {
+	Mu    float64 `json:"mu"`
+	Sigma float64 `json:"sigma"`
+}
+
+// percentilePoint is one entry of a percentile table
+type percentilePoint struct {
+	percentile float64
+	ms         float64
+}
+
+// compile checks the configured distribution and prepares it for sampling:
+// percentile tables are parsed and sorted once, and seeded behaviors get
+// their own source so that the sequence of latencies is reproducible. The
+// source lives as long as the stub does.
+func (w *WaitBehavior) compile() error {
+	switch {
+	case w.Uniform != nil:
+		if w.Uniform.Max < w.Uniform.Min {
+			return util.NewValidationError("uniform wait max must not be less than min", w.Uniform)
+		}
+	case w.Normal != nil:
+		if w.Normal.StdDev < 0 {
+			return util.NewValidationError("normal wait stdDev must not be negative", w.Normal)
+		}
+	case w.LogNormal != nil:
+		if w.LogNormal.Sigma < 0 {
+			return util.NewValidationError("lognormal wait sigma must not be negative", w.LogNormal)
+		}
+	case len(w.Percentiles) > 0:
+		points := make([]percentilePoint, 0, len(w.Percentiles))
+		for key, ms := range w.Percentiles {
+			percentile, err := strconv.ParseFloat(key, 64)
+			if err != nil || percentile < 0 || percentile > 100 {
+				return util.NewValidationError("invalid wait percentile: "+key, w.Percentiles)
+			}
+			points = append(points, percentilePoint{percentile, ms})
+		}
+		sort.Slice(points, func(i, j int) bool { return points[i].percentile < points[j].percentile })
+		w.points = points
+	}
+
+	if w.Seed != nil {
+		w.seeded = rand.New(rand.NewSource(*w.Seed))
+	}
+	w.compiled = true
+	return nil
+}
+
+// waitRandom hands out random sources for wait behaviors
+type waitRandom struct {
+	mu     sync.Mutex
+	global *rand.Rand
+}
+
+func newWaitRandom() *waitRandom {
+	return &waitRandom{
+		global: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// sample draws a latency for the behavior while holding the lock, as
+// rand.Rand is not safe for concurrent use
+func (wr *waitRandom) sample(wait *WaitBehavior) (time.Duration, error) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if !wait.compiled {
+		if err := wait.compile(); err != nil {
+			return 0, err
+		}
+	}
+
+	rng := wr.global
+	if wait.seeded != nil {
+		rng = wait.seeded
+	}
+
+	ms := sampleMilliseconds(wait, rng)
+	if ms < 0 || math.IsNaN(ms) {
+		ms = 0
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// sampleMilliseconds draws from the distribution configured on the behavior
+func sampleMilliseconds(wait *WaitBehavior, rng *rand.Rand) float64 {
+	switch {
+	case wait.Uniform != nil:
+		return wait.Uniform.Min + rng.Float64()*(wait.Uniform.Max-wait.Uniform.Min)
+	case wait.Normal != nil:
+		return wait.Normal.Mean + rng.NormFloat64()*wait.Normal.StdDev
+	case wait.LogNormal != nil:
+		return math.Exp(wait.LogNormal.Mu + rng.NormFloat64()*wait.LogNormal.Sigma)
+	case len(wait.points) > 0:
+		return samplePercentiles(wait.points, rng.Float64()*100)
+	}
+	return float64(wait.Milliseconds)
+}
+
+// samplePercentiles interpolates linearly within a sorted percentile table
+// such as {"50": 100, "99": 800}. Values below the first or above the last
+// percentile take the first or last latency.
+func samplePercentiles(points []percentilePoint, p float64) float64 {
+	if p <= points[0].percentile {
+		return points[0].ms
+	}
+	for i := 1; i < len(points); i++ {
+		lo, hi := points[i-1], points[i]
+		if p <= hi.percentile {
+			fraction := (p - lo.percentile) / (hi.percentile - lo.percentile)
+			return lo.ms + fraction*(hi.ms-lo.ms)
+		}
+	}
+	return points[len(points)-1].ms
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseFormBody parses application/x-www-form-urlencoded and multipart/form-data
+// bodies into a structured map. The second return value is false when the
+// content type is not a form type or the body cannot be parsed, in which case
+// callers should fall back to their normal body handling.
+//
+// Form fields become string values (or arrays when repeated). Multipart file
+// uploads become objects with name, filename, contentType and content fields;
+// binary content is base64 encoded and flagged with "encoding": "base64".
+func ParseFormBody(contentType string, body []byte) (map[string]interface{}, bool) {
+	if contentType == "" || len(body) == 0 {
+		return nil, false
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	switch strings.ToLower(mediaType) {
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, false
+		}
+		result := make(map[string]interface{})
+		for key, vals := range values {
+			for _, val := range vals {
+				addMultiValue(result, key, val)
+			}
+		}
+		return result, true
+
+	case "multipart/form-data":
+		boundary := params["boundary"]
+		if boundary == "" {
+			return nil, false
+		}
+		result, err := parseMultipart(body, boundary)
+		if err != nil {
+			return nil, false
+		}
+		return result, true
+	}
+
+	return nil, false
+}
+
+// parseMultipart reads every part of a multipart body
+func parseMultipart(body []byte, boundary string) (map[string]interface{}, error) {
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	result := make(map[string]interface{})
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		// Plain form fields behave like urlencoded fields so that
+		// predicates such as {"body": {"field": "value"}} keep working
+		if part.FileName() == "" {
+			addMultiValue(result, name, string(content))
+			continue
+		}
+
+		upload := map[string]interface{}{
+			"name":        name,
+			"filename":    part.FileName(),
+			"contentType": part.Header.Get("Content-Type"),
+		}
+		if utf8.Valid(content) {
+			upload["content"] = string(content)
+		} else {
+			upload["content"] = base64.StdEncoding.EncodeToString(content)
+			upload["encoding"] = "base64"
+		}
+		addMultiValue(result, name, upload)
+	}
+}
+
+// ParseQuery converts query parameters into a map, turning repeated
+// parameters into arrays so predicates can match any of their values
+func ParseQuery(values url.Values) map[string]interface{} {
+	query := make(map[string]interface{})
+	for key, vals := range values {
+		for _, val := range vals {
+			addMultiValue(query, key, val)
+		}
+	}
+	return query
+}
+
+// addMultiValue adds a value to the map, turning repeated keys into arrays
+func addMultiValue(values map[string]interface{}, key string, value interface{}) {
+	existing, ok := values[key]
+	if !ok {
+		values[key] = value
+		return
+	}
+
+	if arr, ok := existing.([]interface{}); ok {
+		values[key] = append(arr, value)
+		return
+	}
+	values[key] = []interface{}{existing, value}
+}
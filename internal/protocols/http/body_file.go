@@ -0,0 +1,30 @@
+package http
+
+import (
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// BodyFileContentType infers a content type from the body file's extension
+func BodyFileContentType(path string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// OpenBodyFile opens a body file for streaming, returning its size
+func OpenBodyFile(path string) (*os.File, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
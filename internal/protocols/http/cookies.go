@@ -0,0 +1,39 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+)
+
+// ParseCookies converts the request Cookie header into a map of cookie names
+// to values. Cookies sent more than once become arrays.
+func ParseCookies(r *http.Request) map[string]interface{} {
+	cookies := r.Cookies()
+	if len(cookies) == 0 {
+		return nil
+	}
+
+	result := make(map[string]interface{})
+	for _, cookie := range cookies {
+		addMultiValue(result, cookie.Name, cookie.Value)
+	}
+	return result
+}
+
+// ToHTTPCookie converts a response cookie into a net/http cookie
+func ToHTTPCookie(cookie models.ResponseCookie) (*http.Cookie, error) {
+	return cookie.HTTPCookie()
+}
+
+// WriteCookies adds a Set-Cookie header line for each response cookie
+func WriteCookies(w http.ResponseWriter, cookies models.ResponseCookieList) error {
+	for _, cookie := range cookies {
+		httpCookie, err := ToHTTPCookie(cookie)
+		if err != nil {
+			return err
+		}
+		w.Header().Add("Set-Cookie", httpCookie.String())
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+)
+
+// supportedEncodings lists the content codings we can produce, in order of preference
+var supportedEncodings = []string{"br", "gzip", "deflate"}
+
+// MaxDecodedBodySize bounds a decompressed request body, so a small
+// compressed request cannot expand to fill memory
+var MaxDecodedBodySize int64 = 64 << 20
+
+// ErrBodyTooLarge is returned when a request body decodes to more than
+// MaxDecodedBodySize bytes
+var ErrBodyTooLarge = errors.New("decoded request body is too large")
+
+// DecodeBody reverses the content codings listed in a Content-Encoding header.
+// Codings are applied in the order listed, so they are removed in reverse.
+func DecodeBody(contentEncoding string, body []byte) ([]byte, error) {
+	if contentEncoding == "" || len(body) == 0 {
+		return body, nil
+	}
+
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+
+		var reader io.Reader
+		switch coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			reader = gz
+		case "deflate":
+			reader = deflateReader(body)
+		case "br":
+			reader = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return nil, fmt.Errorf("unsupported content encoding: %s", coding)
+		}
+
+		decoded, err := io.ReadAll(io.LimitReader(reader, MaxDecodedBodySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(decoded)) > MaxDecodedBodySize {
+			return nil, ErrBodyTooLarge
+		}
+		body = decoded
+	}
+
+	return body, nil
+}
+
+// deflateReader returns a reader for a deflate body. Per RFC 9110 deflate means
+// zlib-wrapped data, but many clients send raw deflate, so we accept both.
+func deflateReader(body []byte) io.Reader {
+	if zr, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+		return zr
+	}
+	return flate.NewReader(bytes.NewReader(body))
+}
+
+// EncodeBody compresses a body using the given content coding
+func EncodeBody(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(&buf)
+	case "deflate":
+		writer = zlib.NewWriter(&buf)
+	case "br":
+		writer = brotli.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NegotiateEncoding picks the preferred supported coding allowed by an
+// Accept-Encoding header, or "" if none is acceptable
+func NegotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(entry, ";")
+		coding := strings.ToLower(strings.TrimSpace(parts[0]))
+		if coding == "" {
+			continue
+		}
+
+		weight := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					weight = q
+				}
+			}
+		}
+		weights[coding] = weight
+	}
+
+	best := ""
+	bestWeight := 0.0
+	for _, coding := range supportedEncodings {
+		weight, ok := weights[coding]
+		if !ok {
+			weight, ok = weights["*"]
+		}
+		if ok && weight > bestWeight {
+			best = coding
+			bestWeight = weight
+		}
+	}
+	return best
+}
+
+// ResponseEncoding decides which coding, if any, should be applied to a response.
+// An explicit compression on the response wins; "auto" on the response or
+// compressResponses on the imposter negotiate with Accept-Encoding.
+func ResponseEncoding(response *models.Response, acceptEncoding string, compressResponses bool) string {
+	// Never re-encode a body the stub already declared as encoded
+	if HasHeader(response.Headers, "Content-Encoding") {
+		return ""
+	}
+
+	switch strings.ToLower(response.Compression) {
+	case "gzip", "deflate", "br":
+		return strings.ToLower(response.Compression)
+	case "auto":
+		return NegotiateEncoding(acceptEncoding)
+	case "none", "identity":
+		return ""
+	}
+
+	if compressResponses {
+		return NegotiateEncoding(acceptEncoding)
+	}
+	return ""
+}
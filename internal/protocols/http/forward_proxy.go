@@ -0,0 +1,284 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// tunnelDialTimeout bounds how long a pass-through tunnel waits for the target
+const tunnelDialTimeout = 10 * time.Second
+
+type proxyTargetKey struct{}
+
+// ForwardProxy handles CONNECT tunnels for an imposter acting as an explicit
+// proxy. Without a CA, tunnels are passed through to the target; with one,
+// TLS is terminated using a minted certificate and the decrypted requests are
+// served by the imposter handler.
+type ForwardProxy struct {
+	ca      *util.CertificateAuthority
+	handler http.Handler
+	logger  *util.Logger
+
+	mu      sync.Mutex
+	closers map[io.Closer]struct{}
+}
+
+// NewForwardProxy creates a forward proxy that serves intercepted requests
+// with the given handler. Certificates are minted from the configured CA,
+// or from the local CA if none is configured.
+func NewForwardProxy(config *models.ForwardProxyConfig, logger *util.Logger, localCA *util.LocalCA, handler http.Handler) (*ForwardProxy, error) {
+	p := &ForwardProxy{
+		handler: handler,
+		logger:  logger,
+		closers: make(map[io.Closer]struct{}),
+	}
+
+	if !config.InterceptTLS {
+		return p, nil
+	}
+
+	if config.CACert != "" || config.CAKey != "" {
+		certPEM, err := util.LoadPEM(config.CACert)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := util.LoadPEM(config.CAKey)
+		if err != nil {
+			return nil, err
+		}
+		ca, err := util.LoadCertificateAuthority(certPEM, keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		p.ca = ca
+		return p, nil
+	}
+
+	if localCA != nil {
+		ca, err := localCA.Get()
+		if err == nil {
+			p.ca = ca
+			return p, nil
+		}
+		logger.Warnf("Unable to load local CA: %v", err)
+	}
+
+	ca, err := util.NewCertificateAuthority("mountebank forward proxy CA")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA: %v", err)
+	}
+	logger.Warn("Intercepting TLS with a temporary CA")
+	p.ca = ca
+
+	return p, nil
+}
+
+// HandleConnect establishes a CONNECT tunnel to the requested authority
+func (p *ForwardProxy) HandleConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "CONNECT not supported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		p.logger.Errorf("Unable to hijack CONNECT connection: %v", err)
+		return
+	}
+	if recording, ok := conn.(*RecordingConn); ok {
+		recording.StopRecording()
+	}
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		return
+	}
+
+	// Keep anything the client sent ahead of our response
+	client := &bufferedConn{Conn: conn, reader: rw.Reader}
+
+	if p.ca == nil {
+		p.tunnel(client, r.Host)
+	} else {
+		p.intercept(client, r.Host)
+	}
+}
+
+// tunnel passes the connection through to the target untouched
+func (p *ForwardProxy) tunnel(client net.Conn, authority string) {
+	upstream, err := net.DialTimeout("tcp", authority, tunnelDialTimeout)
+	if err != nil {
+		p.logger.Warnf("Unable to open tunnel to %s: %v", authority, err)
+		client.Close()
+		return
+	}
+
+	p.track(client)
+	p.track(upstream)
+	defer p.untrack(client)
+	defer p.untrack(upstream)
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		dst.Close()
+		done <- struct{}{}
+	}
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+	<-done
+	<-done
+}
+
+// intercept terminates TLS for the target and serves the requests inside the
+// tunnel through the imposter handler
+func (p *ForwardProxy) intercept(client net.Conn, authority string) {
+	target := TargetHost(authority, "443")
+
+	tlsConn := tls.Server(client, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return p.ca.CertificateFor(hello.ServerName)
+			}
+			return p.ca.CertificateFor(target)
+		},
+	})
+
+	listener := newSingleConnListener(&RecordingConn{Conn: tlsConn})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), proxyTargetKey{}, target)
+			p.handler.ServeHTTP(w, r.WithContext(ctx))
+		}),
+		ConnContext: RawHeaderConnContext,
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			RawHeaderConnState(conn, state)
+			if state == http.StateClosed || state == http.StateHijacked {
+				listener.Close()
+			}
+		},
+	}
+
+	p.track(server)
+	defer p.untrack(server)
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed && err != net.ErrClosed {
+		p.logger.Warnf("Intercepted tunnel to %s failed: %v", authority, err)
+	}
+}
+
+// Close closes all open tunnels
+func (p *ForwardProxy) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for closer := range p.closers {
+		closer.Close()
+	}
+	p.closers = make(map[io.Closer]struct{})
+}
+
+func (p *ForwardProxy) track(closer io.Closer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closers[closer] = struct{}{}
+}
+
+func (p *ForwardProxy) untrack(closer io.Closer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.closers, closer)
+}
+
+// ProxyTarget returns the upstream host of a proxied request. Intercepted
+// requests report the CONNECT target; absolute-form requests report the host
+// from their URI. The second result is true for intercepted TLS requests.
+func ProxyTarget(r *http.Request) (string, bool) {
+	if target, ok := r.Context().Value(proxyTargetKey{}).(string); ok {
+		return target, true
+	}
+	if r.URL.IsAbs() {
+		return TargetHost(r.URL.Host, "80"), false
+	}
+	return "", false
+}
+
+// TargetHost strips the default port from a host
+func TargetHost(authority, defaultPort string) string {
+	if host, port, err := net.SplitHostPort(authority); err == nil && port == defaultPort {
+		return host
+	}
+	return authority
+}
+
+// bufferedConn reads through the buffer left over from hijacking
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads buffered bytes before reading from the connection
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// singleConnListener hands out a single connection, then blocks until closed
+type singleConnListener struct {
+	conn net.Conn
+	addr net.Addr
+
+	mu     sync.Mutex
+	done   chan struct{}
+	closed bool
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	return &singleConnListener{
+		conn: conn,
+		addr: conn.LocalAddr(),
+		done: make(chan struct{}),
+	}
+}
+
+// Accept returns the connection on the first call
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	conn := l.conn
+	l.conn = nil
+	l.mu.Unlock()
+
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+// Close unblocks Accept
+func (l *singleConnListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+	return nil
+}
+
+// Addr returns the local address of the connection
+func (l *singleConnListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,279 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxRecordedBytes bounds the per-connection recording buffer. It matches
+// http.DefaultMaxHeaderBytes, so a complete header block always fits.
+const maxRecordedBytes = http.DefaultMaxHeaderBytes
+
+// headerTerminator ends the request header block
+var headerTerminator = []byte("\r\n\r\n")
+
+// canonicalHeaders are interpreted by net/http itself when writing a response,
+// so they are always written using their canonical names
+var canonicalHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+}
+
+type connContextKey struct{}
+
+// RawHeaderListener wraps accepted connections so that the raw request header
+// block can be recovered. net/http canonicalizes header names and loses their
+// order, which makes it impossible to reproduce quirky clients otherwise.
+type RawHeaderListener struct {
+	net.Listener
+}
+
+// NewRawHeaderListener wraps a listener to record request headers
+func NewRawHeaderListener(listener net.Listener) *RawHeaderListener {
+	return &RawHeaderListener{Listener: listener}
+}
+
+// Accept waits for and returns the next recording connection
+func (l *RawHeaderListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingConn{Conn: conn}, nil
+}
+
+// RecordingConn keeps the header block read from a connection until the
+// handler for the request claims it. Only the bytes up to the end of the
+// header block are recorded; recording resumes once the connection is idle
+// and waiting for its next request.
+type RecordingConn struct {
+	net.Conn
+	mu       sync.Mutex
+	buf      []byte
+	complete bool
+	stopped  bool
+}
+
+// Read reads from the underlying connection and records the header block
+func (c *RecordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		if !c.stopped && !c.complete {
+			searchFrom := len(c.buf) - len(headerTerminator) + 1
+			if searchFrom < 0 {
+				searchFrom = 0
+			}
+			c.buf = append(c.buf, p[:n]...)
+			if end := bytes.Index(c.buf[searchFrom:], headerTerminator); end >= 0 {
+				c.buf = c.buf[:searchFrom+end+len(headerTerminator)]
+				c.complete = true
+			} else if len(c.buf) > maxRecordedBytes {
+				// Not a header block net/http will accept; wait for the next one
+				c.buf = nil
+				c.complete = true
+			}
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// StopRecording stops recording, e.g. once the connection is hijacked
+func (c *RecordingConn) StopRecording() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	c.buf = nil
+}
+
+// resetRecording discards the recorded header block so the next request on
+// the connection is recorded from its first byte
+func (c *RecordingConn) resetRecording() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = nil
+	c.complete = false
+}
+
+// ConnectionState returns the TLS state when the connection is TLS
+func (c *RecordingConn) ConnectionState() (tls.ConnectionState, bool) {
+	if tlsConn, ok := c.Conn.(*tls.Conn); ok {
+		return tlsConn.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
+// takeRawHeaders extracts the header lines for the request as alternating
+// name/value entries
+func (c *RecordingConn) takeRawHeaders(r *http.Request) []string {
+	requestLine := []byte(fmt.Sprintf("%s %s ", r.Method, r.RequestURI))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.complete {
+		return nil
+	}
+	start := bytes.Index(c.buf, requestLine)
+	if start < 0 {
+		return nil
+	}
+	end := bytes.Index(c.buf[start:], headerTerminator)
+	if end < 0 {
+		return nil
+	}
+
+	block := string(c.buf[start : start+end])
+	c.buf = nil
+
+	lines := strings.Split(block, "\r\n")[1:]
+	raw := make([]string, 0, 2*len(lines))
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		raw = append(raw, name, strings.TrimSpace(value))
+	}
+	return raw
+}
+
+// RawHeaderConnContext stores the connection in the request context.
+// Use it as http.Server.ConnContext together with RawHeaderListener.
+func RawHeaderConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// RawHeaderConnState restarts recording once a connection goes idle between
+// requests. Use it as http.Server.ConnState together with RawHeaderListener.
+func RawHeaderConnState(c net.Conn, state http.ConnState) {
+	if conn, ok := c.(*RecordingConn); ok && state == http.StateIdle {
+		conn.resetRecording()
+	}
+}
+
+// RequestTLS returns the TLS state of a request, including requests on
+// recording connections that net/http does not recognize as TLS
+func RequestTLS(r *http.Request) *tls.ConnectionState {
+	if r.TLS != nil {
+		return r.TLS
+	}
+	if conn, ok := RequestConn(r); ok {
+		if state, ok := conn.ConnectionState(); ok {
+			return &state
+		}
+	}
+	return nil
+}
+
+// RequestConn returns the recording connection a request arrived on, if any
+func RequestConn(r *http.Request) (*RecordingConn, bool) {
+	conn, ok := r.Context().Value(connContextKey{}).(*RecordingConn)
+	return conn, ok
+}
+
+// RawHeaders returns the request headers as alternating name/value entries in
+// the order and case they were sent. When the raw block cannot be recovered,
+// the canonicalized headers are returned in sorted order instead.
+func RawHeaders(r *http.Request) []string {
+	if conn, ok := RequestConn(r); ok {
+		if raw := conn.takeRawHeaders(r); raw != nil {
+			return raw
+		}
+	}
+
+	raw := make([]string, 0, 2*len(r.Header))
+	if r.Host != "" {
+		raw = append(raw, "Host", r.Host)
+	}
+	for _, key := range sortedKeys(r.Header) {
+		for _, value := range r.Header[key] {
+			raw = append(raw, key, value)
+		}
+	}
+	return raw
+}
+
+// RemoveRawHeader drops every occurrence of a header, matched case-insensitively
+func RemoveRawHeader(raw []string, name string) []string {
+	kept := make([]string, 0, len(raw))
+	for i := 0; i+1 < len(raw); i += 2 {
+		if !strings.EqualFold(raw[i], name) {
+			kept = append(kept, raw[i], raw[i+1])
+		}
+	}
+	return kept
+}
+
+// HeadersFromRaw groups raw headers by case-insensitive name. The first
+// spelling of each name is kept; repeated headers become arrays in order.
+func HeadersFromRaw(raw []string) map[string]interface{} {
+	headers := make(map[string]interface{})
+	names := make(map[string]string)
+
+	for i := 0; i+1 < len(raw); i += 2 {
+		lower := strings.ToLower(raw[i])
+		name, ok := names[lower]
+		if !ok {
+			name = raw[i]
+			names[lower] = name
+		}
+		addMultiValue(headers, name, raw[i+1])
+	}
+	return headers
+}
+
+// WriteHeaders copies response headers to the writer, keeping the configured
+// name case. Array values are written as repeated header lines in order.
+func WriteHeaders(h http.Header, headers map[string]interface{}) {
+	for key, value := range headers {
+		name := key
+		if canonical := textproto.CanonicalMIMEHeaderKey(key); canonicalHeaders[canonical] {
+			name = canonical
+		}
+
+		switch v := value.(type) {
+		case string:
+			h[name] = append(h[name], v)
+		case []string:
+			h[name] = append(h[name], v...)
+		case []interface{}:
+			for _, val := range v {
+				h[name] = append(h[name], fmt.Sprint(val))
+			}
+		default:
+			h[name] = append(h[name], fmt.Sprint(v))
+		}
+	}
+}
+
+// sortedKeys returns the keys of a header map in sorted order
+func sortedKeys(header http.Header) []string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// HasHeader reports whether headers contain a name, ignoring case
+func HasHeader(headers map[string]interface{}, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
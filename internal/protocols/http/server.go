@@ -2,11 +2,13 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,10 +25,13 @@ type Server struct {
 	stubs       *models.StubRepository
 	getResponse func(*models.Request, map[string]interface{}) (*models.Response, error)
 	allowCORS   bool
+
+	compressResponses bool
+	forwardProxy      *ForwardProxy
 }
 
 // Create creates a new HTTP server
-func Create(config *models.ImposterConfig, logger *util.Logger, getResponse func(*models.Request, map[string]interface{}) (*models.Response, error)) (*Server, error) {
+func Create(config *models.ImposterConfig, logger *util.Logger, ca *util.LocalCA, getResponse func(*models.Request, map[string]interface{}) (*models.Response, error)) (*Server, error) {
 	port := config.Port
 	if port == 0 {
 		// Find available port
@@ -38,7 +43,7 @@ func Create(config *models.ImposterConfig, logger *util.Logger, getResponse func
 		listener.Close()
 	}
 
-	stubs := models.NewStubRepository(config.Stubs, config.Requests, logger, nil)
+	stubs := models.NewStubRepository(config.Stubs, config.Requests, "utf8", logger, nil)
 
 	s := &Server{
 		port:        port,
@@ -46,22 +51,35 @@ func Create(config *models.ImposterConfig, logger *util.Logger, getResponse func
 		stubs:       stubs,
 		getResponse: getResponse,
 		allowCORS:   config.AllowCORS,
+
+		compressResponses: config.CompressResponses,
 	}
 
 	// Create HTTP handler
 	handler := http.HandlerFunc(s.handleRequest)
 
+	if config.ForwardProxy != nil {
+		forwardProxy, err := NewForwardProxy(config.ForwardProxy, logger, ca, handler)
+		if err != nil {
+			return nil, err
+		}
+		s.forwardProxy = forwardProxy
+	}
+
 	// Create HTTP server
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: handler,
+		Addr:        fmt.Sprintf(":%d", port),
+		Handler:     handler,
+		ConnContext: RawHeaderConnContext,
+		ConnState:   RawHeaderConnState,
 	}
 
-	// Start listening
-	listener, err := net.Listen("tcp", s.server.Addr)
+	// Start listening, recording raw headers to preserve their case and order
+	tcpListener, err := net.Listen("tcp", s.server.Addr)
 	if err != nil {
 		return nil, err
 	}
+	listener := NewRawHeaderListener(tcpListener)
 	s.listener = listener
 
 	// Start server in goroutine
@@ -88,6 +106,12 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 		s.logger.Info(msg)
 	}()
 
+	// Tunnel CONNECT requests when acting as a forward proxy
+	if r.Method == http.MethodConnect && s.forwardProxy != nil {
+		s.forwardProxy.HandleConnect(w, r)
+		return
+	}
+
 	// Handle CORS
 	if s.allowCORS {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -102,6 +126,10 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// Convert HTTP request to mountebank request
 	request, err := s.httpToRequest(r)
+	if errors.Is(err, ErrBodyTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		s.logger.Errorf("Error converting request: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -159,7 +187,13 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert mountebank response to HTTP response
-	s.responseToHTTP(response, w)
+	s.responseToHTTP(response, w, r)
+
+	// Let callbacks follow the response onto the wire
+	if response.AfterSend != nil {
+		Flusher(w)()
+		response.AfterSend()
+	}
 }
 
 // httpToRequest converts an HTTP request to a mountebank request
@@ -171,46 +205,46 @@ func (s *Server) httpToRequest(r *http.Request) (*models.Request, error) {
 	}
 	defer r.Body.Close()
 
-	// Parse query parameters
-	query := make(map[string]interface{})
-	for key, values := range r.URL.Query() {
-		if len(values) == 1 {
-			query[key] = values[0]
+	// Decode compressed bodies so predicates see the original payload
+	decoded := false
+	if contentEncoding := r.Header.Get("Content-Encoding"); contentEncoding != "" {
+		plain, err := DecodeBody(contentEncoding, bodyBytes)
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			s.logger.Warnf("Unable to decode %s request body: %v", contentEncoding, err)
 		} else {
-			query[key] = values
+			bodyBytes = plain
+			decoded = true
 		}
 	}
 
-	// Parse headers
-	headers := make(map[string]interface{})
-	for key, values := range r.Header {
-		if len(values) == 1 {
-			headers[key] = values[0]
-		} else {
-			headers[key] = values
-		}
+	// Parse query parameters
+	query := ParseQuery(r.URL.Query())
+
+	// Parse headers, keeping the names as sent by the client
+	rawHeaders := RawHeaders(r)
+	if decoded {
+		// The recorded body is the decoded one, so it no longer has a coding
+		rawHeaders = RemoveRawHeader(rawHeaders, "Content-Encoding")
 	}
+	headers := HeadersFromRaw(rawHeaders)
 
 	// Parse body based on Content-Type
 	var body interface{}
 	isJSON := false
-	if contentType, ok := headers["Content-Type"]; ok {
-		if ctStr, ok := contentType.(string); ok {
-			if strings.Contains(strings.ToLower(ctStr), "json") {
-				isJSON = true
-			}
-		} else if ctSlice, ok := contentType.([]string); ok { // Should not happen with current logic but for safety
-			for _, v := range ctSlice {
-				if strings.Contains(strings.ToLower(v), "json") {
-					isJSON = true
-					break
-				}
-			}
+	for _, contentType := range r.Header.Values("Content-Type") {
+		if strings.Contains(strings.ToLower(contentType), "json") {
+			isJSON = true
+			break
 		}
 	}
 
 	if len(bodyBytes) > 0 {
-		if isJSON {
+		if form, ok := ParseFormBody(r.Header.Get("Content-Type"), bodyBytes); ok {
+			body = form
+		} else if isJSON {
 			if err := json.Unmarshal(bodyBytes, &body); err != nil {
 				// If JSON parsing fails, fall back to string
 				body = string(bodyBytes)
@@ -231,13 +265,23 @@ func (s *Server) httpToRequest(r *http.Request) (*models.Request, error) {
 		host = r.RemoteAddr
 	}
 
+	// Requests intercepted from a CONNECT tunnel were sent over TLS
+	protocol := "http"
+	target, intercepted := ProxyTarget(r)
+	if intercepted {
+		protocol = "https"
+	}
+
 	return &models.Request{
 		RequestFrom: r.RemoteAddr,
-		Protocol:    "http",
+		Protocol:    protocol,
+		Host:        target,
 		Method:      r.Method,
 		Path:        r.URL.Path,
 		Query:       query,
 		Headers:     headers,
+		RawHeaders:  rawHeaders,
+		Cookies:     ParseCookies(r),
 		Body:        body,
 		IP:          host,
 		Timestamp:   time.Now().Format(time.RFC3339),
@@ -245,30 +289,13 @@ func (s *Server) httpToRequest(r *http.Request) (*models.Request, error) {
 }
 
 // responseToHTTP converts a mountebank response to an HTTP response
-func (s *Server) responseToHTTP(response *models.Response, w http.ResponseWriter) {
+func (s *Server) responseToHTTP(response *models.Response, w http.ResponseWriter, r *http.Request) {
 	// 1. Process headers from config
-	hasContentType := false
-	if response.Headers != nil {
-		for key, value := range response.Headers {
-			if strings.EqualFold(key, "Content-Type") {
-				hasContentType = true
-			}
-			switch v := value.(type) {
-			case string:
-				w.Header().Set(key, v)
-			case []string:
-				for _, val := range v {
-					w.Header().Add(key, val)
-				}
-			case []interface{}:
-				// Flatten JSON arrays to single value (take 1st element) as requested
-				if len(v) > 0 {
-					w.Header().Set(key, fmt.Sprint(v[0]))
-				}
-			default:
-				w.Header().Set(key, fmt.Sprint(v))
-			}
-		}
+	hasContentType := HasHeader(response.Headers, "Content-Type")
+	WriteHeaders(w.Header(), response.Headers)
+
+	if err := WriteCookies(w, response.Cookies); err != nil {
+		s.logger.Warnf("Unable to write response cookies: %v", err)
 	}
 
 	// 2. Prepare body and determine implicit content type
@@ -292,9 +319,34 @@ func (s *Server) responseToHTTP(response *models.Response, w http.ResponseWriter
 		}
 	}
 
+	// Stream body files, unless throttling or compression needs the bytes
+	var bodyFile io.Reader
+	var bodyFileSize int64
+	if response.Body == nil && response.BodyFile != "" {
+		file, size, err := OpenBodyFile(response.BodyFile)
+		if err != nil {
+			s.logger.Errorf("Unable to open body file: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		if response.Throttle != nil || ResponseEncoding(response, r.Header.Get("Accept-Encoding"), s.compressResponses) != "" {
+			if bodyBytes, err = io.ReadAll(file); err != nil {
+				s.logger.Errorf("Unable to read body file: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		} else {
+			bodyFile, bodyFileSize = file, size
+		}
+	}
+
 	// 3. Set implicit content type or suppress sniffing
 	if !hasContentType {
-		if implicitJSON {
+		if response.BodyFile != "" {
+			w.Header().Set("Content-Type", BodyFileContentType(response.BodyFile))
+		} else if implicitJSON {
 			w.Header().Set("Content-Type", "application/json")
 		} else {
 			// Suppress sniffing for explicit text/bytes to match Node.js behavior
@@ -303,15 +355,43 @@ func (s *Server) responseToHTTP(response *models.Response, w http.ResponseWriter
 		}
 	}
 
-	// 4. Write status code
+	// 4. Compress body if requested by the stub or allowed by the client
 	statusCode := response.StatusCode
 	if statusCode == 0 {
 		statusCode = 200
 	}
+	if len(bodyBytes) > 0 && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified {
+		if encoding := ResponseEncoding(response, r.Header.Get("Accept-Encoding"), s.compressResponses); encoding != "" {
+			if encoded, err := EncodeBody(encoding, bodyBytes); err != nil {
+				s.logger.Warnf("Unable to %s encode response body: %v", encoding, err)
+			} else {
+				bodyBytes = encoded
+				w.Header().Set("Content-Encoding", encoding)
+				w.Header().Set("Content-Length", strconv.Itoa(len(bodyBytes)))
+				w.Header().Add("Vary", "Accept-Encoding")
+			}
+		}
+	}
+
+	// 5. Write status code, announcing the full length of throttled bodies
+	if response.Throttle != nil && len(bodyBytes) > 0 && w.Header().Get("Content-Length") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(bodyBytes)))
+	}
+	if bodyFile != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(bodyFileSize, 10))
+	}
 	w.WriteHeader(statusCode)
 
-	// 5. Write body
-	if len(bodyBytes) > 0 {
+	// 6. Write body
+	if bodyFile != nil {
+		if _, err := io.Copy(w, bodyFile); err != nil {
+			s.logger.Warnf("Unable to stream body file: %v", err)
+		}
+	} else if response.Throttle != nil {
+		if err := WriteThrottled(w, Flusher(w), bodyBytes, response.Throttle, r.Context().Done()); err != nil {
+			s.logger.Warnf("Unable to write throttled response: %v", err)
+		}
+	} else if len(bodyBytes) > 0 {
 		w.Write(bodyBytes)
 	}
 }
@@ -333,6 +413,9 @@ func (s *Server) Close(callback func()) error {
 			s.logger.Errorf("Error closing HTTP server: %v", err)
 		}
 	}
+	if s.forwardProxy != nil {
+		s.forwardProxy.Close()
+	}
 	if callback != nil {
 		callback()
 	}
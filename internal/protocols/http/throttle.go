@@ -0,0 +1,98 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+)
+
+// throttleInterval is how often a bytesPerSecond throttle writes
+const throttleInterval = 100 * time.Millisecond
+
+// WriteThrottled writes body slowly according to the throttle. flush is
+// called after every write so that each chunk reaches the client, and done
+// aborts the write, e.g. when the client disconnects or the imposter stops.
+// It is independent of HTTP so other protocol writers can use it.
+func WriteThrottled(w io.Writer, flush func(), body []byte, throttle *models.ThrottleBehavior, done <-chan struct{}) error {
+	flush()
+
+	if !sleepUnlessDone(time.Duration(throttle.FirstByteDelay)*time.Millisecond, done) {
+		return nil
+	}
+
+	// Only write up to the stall point
+	limit := len(body)
+	if throttle.StallAfter != nil && *throttle.StallAfter < limit {
+		limit = *throttle.StallAfter
+	}
+
+	chunkSize, delay := throttleChunks(throttle, limit)
+	for written := 0; written < limit; {
+		end := written + chunkSize
+		if end > limit {
+			end = limit
+		}
+		if _, err := w.Write(body[written:end]); err != nil {
+			return err
+		}
+		flush()
+		written = end
+
+		if written < limit && !sleepUnlessDone(delay, done) {
+			return nil
+		}
+	}
+
+	// Stall with the connection open until released
+	if limit < len(body) {
+		<-done
+	}
+	return nil
+}
+
+// throttleChunks returns the chunk size and the delay between chunks
+func throttleChunks(throttle *models.ThrottleBehavior, length int) (int, time.Duration) {
+	if throttle.BytesPerSecond != nil && *throttle.BytesPerSecond > 0 {
+		bytesPerSecond := int64(*throttle.BytesPerSecond)
+		chunkSize := int(bytesPerSecond * int64(throttleInterval) / int64(time.Second))
+		if chunkSize < 1 {
+			chunkSize = 1
+		}
+		delay := time.Duration(int64(chunkSize) * int64(time.Second) / bytesPerSecond)
+		return chunkSize, delay
+	}
+
+	chunkSize := length
+	if throttle.ChunkSize != nil && *throttle.ChunkSize > 0 {
+		chunkSize = *throttle.ChunkSize
+	}
+	return chunkSize, time.Duration(throttle.ChunkDelay) * time.Millisecond
+}
+
+// Flusher returns a function flushing buffered response data to the client
+func Flusher(w http.ResponseWriter) func() {
+	return func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// sleepUnlessDone sleeps for d, returning false if done closes first
+func sleepUnlessDone(d time.Duration, done <-chan struct{}) bool {
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,97 @@
+package https
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	httpproto "github.com/mountebank-testing/mountebank-go/internal/protocols/http"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// handshakeTimeout bounds how long a client may take to complete the TLS
+// handshake
+const handshakeTimeout = 10 * time.Second
+
+// tlsListener completes the TLS handshake before handing connections to the
+// HTTP server. HTTP/1.x connections are wrapped to record their raw headers;
+// connections that negotiated h2 are returned as the *tls.Conn itself so
+// net/http can serve them over HTTP/2.
+type tlsListener struct {
+	net.Listener
+	config *tls.Config
+	logger *util.Logger
+	conns  chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+}
+
+// newTLSListener starts accepting connections from a TCP listener
+func newTLSListener(inner net.Listener, config *tls.Config, logger *util.Logger) *tlsListener {
+	l := &tlsListener{
+		Listener: inner,
+		config:   config,
+		logger:   logger,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+// acceptLoop handshakes each accepted connection on its own goroutine, so a
+// slow client cannot hold up the others
+func (l *tlsListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.Close()
+			return
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake completes the TLS handshake and queues the connection for Accept
+func (l *tlsListener) handshake(conn net.Conn) {
+	tlsConn := tls.Server(conn, l.config)
+	tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		l.logger.Debugf("TLS handshake error from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	var ready net.Conn = tlsConn
+	if tlsConn.ConnectionState().NegotiatedProtocol != "h2" {
+		ready = &httpproto.RecordingConn{Conn: tlsConn}
+	}
+
+	select {
+	case l.conns <- ready:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// Accept returns the next connection that completed its handshake
+func (l *tlsListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting connections
+func (l *tlsListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.Listener.Close()
+	})
+	return err
+}
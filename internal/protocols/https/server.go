@@ -5,13 +5,16 @@ import (
 	"crypto/x509"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/mountebank-testing/mountebank-go/internal/models"
+	httpproto "github.com/mountebank-testing/mountebank-go/internal/protocols/http"
 	"github.com/mountebank-testing/mountebank-go/internal/util"
 )
 
@@ -30,10 +33,12 @@ type Server struct {
 	stubs       *models.StubRepository
 	getResponse func(*models.Request, map[string]interface{}) (*models.Response, error)
 	allowCORS   bool
+
+	compressResponses bool
 }
 
 // Create creates a new HTTPS server
-func Create(config *models.ImposterConfig, logger *util.Logger, getResponse func(*models.Request, map[string]interface{}) (*models.Response, error)) (*Server, error) {
+func Create(config *models.ImposterConfig, logger *util.Logger, ca *util.LocalCA, getResponse func(*models.Request, map[string]interface{}) (*models.Response, error)) (*Server, error) {
 	port := config.Port
 	if port == 0 {
 		// Find available port
@@ -45,7 +50,7 @@ func Create(config *models.ImposterConfig, logger *util.Logger, getResponse func
 		listener.Close()
 	}
 
-	stubs := models.NewStubRepository(config.Stubs, config.Requests, logger, nil)
+	stubs := models.NewStubRepository(config.Stubs, config.Requests, "utf8", logger, nil)
 
 	s := &Server{
 		port:        port,
@@ -53,39 +58,83 @@ func Create(config *models.ImposterConfig, logger *util.Logger, getResponse func
 		stubs:       stubs,
 		getResponse: getResponse,
 		allowCORS:   config.AllowCORS,
+
+		compressResponses: config.CompressResponses,
 	}
 
-	// Load certificate
-	var certPEM, keyPEM []byte
-	if config.Cert != "" {
-		certPEM = []byte(config.Cert)
-	} else {
-		certPEM = defaultCert
+	// Load certificate. Without one, certificates are minted from the local
+	// CA for each requested host name or IP address.
+	var cert *tls.Certificate
+	var certPEM []byte
+	var err error
+	if config.Cert != "" || config.Key != "" {
+		cert, certPEM, err = loadKeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key pair: %v", err)
+		}
 	}
 
-	if config.Key != "" {
-		keyPEM = []byte(config.Key)
-	} else {
-		keyPEM = defaultKey
+	var authority *util.CertificateAuthority
+	if cert == nil && ca != nil {
+		if authority, err = ca.Get(); err != nil {
+			logger.Warnf("Unable to load local CA, using the default certificate: %v", err)
+		} else {
+			certPEM = authority.CertPEM()
+		}
 	}
 
-	cert, err := tls.X509KeyPair(certPEM, keyPEM)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load key pair: %v", err)
+	if cert == nil && authority == nil {
+		if cert, certPEM, err = loadKeyPair(string(defaultCert), string(defaultKey)); err != nil {
+			return nil, fmt.Errorf("failed to load key pair: %v", err)
+		}
+	}
+
+	// Load certificates for virtual hosts, falling back to the imposter's own
+	hostPatterns := make([]string, len(config.VirtualHosts))
+	hostCerts := make([]*tls.Certificate, len(config.VirtualHosts))
+	for i, vh := range config.VirtualHosts {
+		hostPatterns[i] = vh.Host
+		if vh.Cert == "" && vh.Key == "" {
+			continue
+		}
+		hostCert, _, err := loadKeyPair(vh.Cert, vh.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key pair for virtual host %s: %v", vh.Host, err)
+		}
+		hostCerts[i] = hostCert
 	}
 
 	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if i := models.FindVirtualHost(hostPatterns, hello.ServerName); i >= 0 && hostCerts[i] != nil {
+				return hostCerts[i], nil
+			}
+			if cert != nil {
+				return cert, nil
+			}
+			return authority.CertificateFor(requestedHost(hello))
+		},
 	}
 
-	// Handle mutual authentication
+	if err := applyTLSOptions(tlsConfig, config.TLS); err != nil {
+		return nil, err
+	}
+
+	// Handle mutual authentication, trusting the imposter's own certificate
+	// unless a CA is provided
 	if config.MutualAuth {
 		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-		// Use the same cert as CA for now if no CA provided
-		// TODO: Support custom CA
+		clientCAPEM := certPEM
+		if config.CA != "" {
+			if clientCAPEM, err = util.LoadPEM(config.CA); err != nil {
+				return nil, err
+			}
+		}
 		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(certPEM)
+		if !caCertPool.AppendCertsFromPEM(clientCAPEM) {
+			return nil, fmt.Errorf("failed to load CA certificate")
+		}
 		tlsConfig.ClientCAs = caCertPool
 	}
 
@@ -94,16 +143,19 @@ func Create(config *models.ImposterConfig, logger *util.Logger, getResponse func
 
 	// Create HTTP server
 	s.server = &http.Server{
-		Addr:      fmt.Sprintf(":%d", port),
-		Handler:   handler,
-		TLSConfig: tlsConfig,
+		Addr:        fmt.Sprintf(":%d", port),
+		Handler:     handler,
+		TLSConfig:   tlsConfig,
+		ConnContext: httpproto.RawHeaderConnContext,
+		ConnState:   httpproto.RawHeaderConnState,
 	}
 
-	// Start listening
-	listener, err := tls.Listen("tcp", s.server.Addr, tlsConfig)
+	// Start listening, recording the decrypted raw headers
+	tcpListener, err := net.Listen("tcp", s.server.Addr)
 	if err != nil {
 		return nil, err
 	}
+	listener := newTLSListener(tcpListener, tlsConfig, logger)
 	s.listener = listener
 
 	// Start server in goroutine
@@ -121,6 +173,7 @@ func Create(config *models.ImposterConfig, logger *util.Logger, getResponse func
 // handleRequest handles incoming HTTPS requests
 func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	r.TLS = httpproto.RequestTLS(r)
 	defer func() {
 		duration := time.Since(start)
 		msg := fmt.Sprintf("[IMPOSTER:%d] %s %s took %v", s.port, r.Method, r.URL.String(), duration)
@@ -144,6 +197,10 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// Convert HTTP request to mountebank request
 	request, err := s.httpToRequest(r)
+	if errors.Is(err, httpproto.ErrBodyTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		s.logger.Errorf("Error converting request: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -165,7 +222,13 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert mountebank response to HTTP response
-	s.responseToHTTP(response, w)
+	s.responseToHTTP(response, w, r)
+
+	// Let callbacks follow the response onto the wire
+	if response.AfterSend != nil {
+		httpproto.Flusher(w)()
+		response.AfterSend()
+	}
 }
 
 // httpToRequest converts an HTTP request to a mountebank request
@@ -177,49 +240,66 @@ func (s *Server) httpToRequest(r *http.Request) (*models.Request, error) {
 	}
 	defer r.Body.Close()
 
-	// Parse query parameters
-	query := make(map[string]interface{})
-	for key, values := range r.URL.Query() {
-		if len(values) == 1 {
-			query[key] = values[0]
+	// Decode compressed bodies so predicates see the original payload
+	decoded := false
+	if contentEncoding := r.Header.Get("Content-Encoding"); contentEncoding != "" {
+		plain, err := httpproto.DecodeBody(contentEncoding, bodyBytes)
+		if errors.Is(err, httpproto.ErrBodyTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			s.logger.Warnf("Unable to decode %s request body: %v", contentEncoding, err)
 		} else {
-			query[key] = values
+			bodyBytes = plain
+			decoded = true
 		}
 	}
 
-	// Parse headers
-	headers := make(map[string]interface{})
-	for key, values := range r.Header {
-		if len(values) == 1 {
-			headers[key] = values[0]
-		} else {
-			headers[key] = values
-		}
+	// Parse query parameters
+	query := httpproto.ParseQuery(r.URL.Query())
+
+	// Parse headers, keeping the names as sent by the client
+	rawHeaders := httpproto.RawHeaders(r)
+	if decoded {
+		// The recorded body is the decoded one, so it no longer has a coding
+		rawHeaders = httpproto.RemoveRawHeader(rawHeaders, "Content-Encoding")
 	}
+	headers := httpproto.HeadersFromRaw(rawHeaders)
 
-	// Try to parse body as JSON
+	// Parse form bodies, otherwise try to parse body as JSON
 	var body interface{}
-	if len(bodyBytes) > 0 {
+	if form, ok := httpproto.ParseFormBody(r.Header.Get("Content-Type"), bodyBytes); ok {
+		body = form
+	} else if len(bodyBytes) > 0 {
 		if err := json.Unmarshal(bodyBytes, &body); err != nil {
 			// If not JSON, use as string
 			body = string(bodyBytes)
 		}
 	}
 
+	// Record the server name used to select the virtual host
+	var serverName string
+	if r.TLS != nil {
+		serverName = r.TLS.ServerName
+	}
+
 	return &models.Request{
-		Protocol:  "https",
-		Method:    r.Method,
-		Path:      r.URL.Path,
-		Query:     query,
-		Headers:   headers,
-		Body:      body,
-		IP:        r.RemoteAddr,
-		Timestamp: time.Now().Format(time.RFC3339),
+		Protocol:   "https",
+		ServerName: serverName,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      query,
+		Headers:    headers,
+		RawHeaders: rawHeaders,
+		Cookies:    httpproto.ParseCookies(r),
+		Body:       body,
+		IP:         r.RemoteAddr,
+		Timestamp:  time.Now().Format(time.RFC3339),
 	}, nil
 }
 
 // responseToHTTP converts a mountebank response to an HTTP response
-func (s *Server) responseToHTTP(response *models.Response, w http.ResponseWriter) {
+func (s *Server) responseToHTTP(response *models.Response, w http.ResponseWriter, r *http.Request) {
 	// Set status code
 	statusCode := response.StatusCode
 	if statusCode == 0 {
@@ -227,41 +307,127 @@ func (s *Server) responseToHTTP(response *models.Response, w http.ResponseWriter
 	}
 
 	// Set headers
-	if response.Headers != nil {
-		for key, value := range response.Headers {
-			switch v := value.(type) {
-			case string:
-				w.Header().Set(key, v)
-			case []string:
-				for _, val := range v {
-					w.Header().Add(key, val)
-				}
-			default:
-				w.Header().Set(key, fmt.Sprint(v))
-			}
-		}
-	}
+	hasContentType := httpproto.HasHeader(response.Headers, "Content-Type")
+	httpproto.WriteHeaders(w.Header(), response.Headers)
 
-	// Write status code
-	w.WriteHeader(statusCode)
+	if err := httpproto.WriteCookies(w, response.Cookies); err != nil {
+		s.logger.Warnf("Unable to write response cookies: %v", err)
+	}
 
-	// Write body
+	// Prepare body
+	var bodyBytes []byte
 	if response.Body != nil {
 		switch body := response.Body.(type) {
 		case string:
-			w.Write([]byte(body))
+			bodyBytes = []byte(body)
 		case []byte:
-			w.Write(body)
+			bodyBytes = body
 		default:
 			// Try to marshal as JSON
 			if data, err := json.Marshal(body); err == nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.Write(data)
+				if !hasContentType {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				bodyBytes = data
 			} else {
-				w.Write([]byte(fmt.Sprint(body)))
+				bodyBytes = []byte(fmt.Sprint(body))
 			}
 		}
 	}
+
+	// Stream body files, unless throttling or compression needs the bytes
+	var bodyFile io.Reader
+	var bodyFileSize int64
+	if response.Body == nil && response.BodyFile != "" {
+		file, size, err := httpproto.OpenBodyFile(response.BodyFile)
+		if err != nil {
+			s.logger.Errorf("Unable to open body file: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		if response.Throttle != nil || httpproto.ResponseEncoding(response, r.Header.Get("Accept-Encoding"), s.compressResponses) != "" {
+			if bodyBytes, err = io.ReadAll(file); err != nil {
+				s.logger.Errorf("Unable to read body file: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		} else {
+			bodyFile, bodyFileSize = file, size
+		}
+	}
+	if !hasContentType && response.BodyFile != "" {
+		w.Header().Set("Content-Type", httpproto.BodyFileContentType(response.BodyFile))
+	}
+
+	// Compress body if requested by the stub or allowed by the client
+	if len(bodyBytes) > 0 && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified {
+		if encoding := httpproto.ResponseEncoding(response, r.Header.Get("Accept-Encoding"), s.compressResponses); encoding != "" {
+			if encoded, err := httpproto.EncodeBody(encoding, bodyBytes); err != nil {
+				s.logger.Warnf("Unable to %s encode response body: %v", encoding, err)
+			} else {
+				bodyBytes = encoded
+				w.Header().Set("Content-Encoding", encoding)
+				w.Header().Set("Content-Length", strconv.Itoa(len(bodyBytes)))
+				w.Header().Add("Vary", "Accept-Encoding")
+			}
+		}
+	}
+
+	// Write status code, announcing the full length of throttled bodies
+	if response.Throttle != nil && len(bodyBytes) > 0 && w.Header().Get("Content-Length") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(bodyBytes)))
+	}
+	if bodyFile != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(bodyFileSize, 10))
+	}
+	w.WriteHeader(statusCode)
+
+	// Write body
+	if bodyFile != nil {
+		if _, err := io.Copy(w, bodyFile); err != nil {
+			s.logger.Warnf("Unable to stream body file: %v", err)
+		}
+	} else if response.Throttle != nil {
+		if err := httpproto.WriteThrottled(w, httpproto.Flusher(w), bodyBytes, response.Throttle, r.Context().Done()); err != nil {
+			s.logger.Warnf("Unable to write throttled response: %v", err)
+		}
+	} else if len(bodyBytes) > 0 {
+		w.Write(bodyBytes)
+	}
+}
+
+// loadKeyPair loads a certificate and key given inline or as file paths
+func loadKeyPair(certValue, keyValue string) (*tls.Certificate, []byte, error) {
+	certPEM, err := util.LoadPEM(certValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := util.LoadPEM(keyValue)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &cert, certPEM, nil
+}
+
+// requestedHost returns the server name sent by the client, or the local IP
+// address the client connected to when it sent none
+func requestedHost(hello *tls.ClientHelloInfo) string {
+	if hello.ServerName != "" {
+		return hello.ServerName
+	}
+	if hello.Conn != nil {
+		if host, _, err := net.SplitHostPort(hello.Conn.LocalAddr().String()); err == nil {
+			return host
+		}
+	}
+	return "localhost"
 }
 
 // Port returns the port the server is listening on
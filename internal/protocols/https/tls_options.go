@@ -0,0 +1,102 @@
+package https
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"x25519": tls.X25519,
+	"p256":   tls.CurveP256,
+	"p384":   tls.CurveP384,
+	"p521":   tls.CurveP521,
+}
+
+// applyTLSOptions applies imposter TLS options to a server configuration.
+// Insecure versions and cipher suites are allowed so that clients can be
+// tested against legacy servers.
+func applyTLSOptions(config *tls.Config, options *models.TLSOptions) error {
+	if options == nil {
+		return nil
+	}
+
+	if options.MinVersion != "" {
+		version, err := parseTLSVersion(options.MinVersion)
+		if err != nil {
+			return err
+		}
+		config.MinVersion = version
+	}
+	if options.MaxVersion != "" {
+		version, err := parseTLSVersion(options.MaxVersion)
+		if err != nil {
+			return err
+		}
+		config.MaxVersion = version
+
+		// A legacy maximum implies the same minimum unless one is given
+		if options.MinVersion == "" && config.MinVersion > version {
+			config.MinVersion = version
+		}
+	}
+	if config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return util.NewValidationError("tls minVersion must not be greater than maxVersion", options)
+	}
+
+	for _, name := range options.CipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return util.NewValidationError("unknown tls cipher suite: "+name, options.CipherSuites)
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+
+	for _, name := range options.Curves {
+		key := strings.ToLower(strings.TrimPrefix(name, "Curve"))
+		curve, ok := tlsCurves[key]
+		if !ok {
+			return util.NewValidationError("unknown tls curve: "+name, options.Curves)
+		}
+		config.CurvePreferences = append(config.CurvePreferences, curve)
+	}
+
+	config.NextProtos = options.ALPN
+
+	if options.SessionTickets != nil {
+		config.SessionTicketsDisabled = !*options.SessionTickets
+	}
+
+	return nil
+}
+
+// parseTLSVersion accepts versions such as 1.2, TLSv1.2 or TLS1.2
+func parseTLSVersion(value string) (uint16, error) {
+	key := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(value), "tls"), "v")
+	version, ok := tlsVersions[key]
+	if !ok {
+		return 0, util.NewValidationError("unknown tls version: "+value, value)
+	}
+	return version, nil
+}
+
+// cipherSuiteID looks up a cipher suite, including insecure ones, by name
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			if strings.EqualFold(suite.Name, name) {
+				return suite.ID, true
+			}
+		}
+	}
+	return 0, false
+}
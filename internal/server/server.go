@@ -10,6 +10,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -46,6 +47,18 @@ type Config struct {
 	LogConfig      string
 	ImpostersRepo  string
 	PidFile        string
+	CADir          string
+	BodyRoot       string
+
+	// InjectionTimeout limits injected scripts, in milliseconds; zero means
+	// no limit
+	InjectionTimeout int
+
+	// ModulesDir is the directory injected scripts can require modules from
+	ModulesDir string
+
+	// PersistState saves script state through the data store
+	PersistState bool
 }
 
 // Server represents the mountebank server
@@ -55,6 +68,7 @@ type Server struct {
 	logger     *util.Logger
 	repository *models.ImposterRepository
 	renderer   *web.Renderer
+	ca         *util.LocalCA
 }
 
 var startTime = time.Now()
@@ -68,7 +82,7 @@ func New(config *Config) (*Server, error) {
 	var err error
 
 	if config.ImpostersRepo != "" {
-		dataStore, err = models.NewGojaDataStore(config.ImpostersRepo, logger)
+		dataStore, err = models.NewGojaDataStore(config.ImpostersRepo, config.ModulesDir, time.Duration(config.InjectionTimeout)*time.Millisecond, logger)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize custom repository: %v", err)
 		}
@@ -81,6 +95,11 @@ func New(config *Config) (*Server, error) {
 	}
 
 	repository := models.NewImposterRepository(logger, dataStore)
+	if config.PersistState {
+		if err := repository.State().Persist(dataStore, logger); err != nil {
+			logger.Errorf("Failed to load state from data store: %v", err)
+		}
+	}
 
 	// Initialize renderer
 	viewsFS, err := fs.Sub(web.GetAssets(), "views")
@@ -92,11 +111,18 @@ func New(config *Config) (*Server, error) {
 		return nil, err
 	}
 
+	// The local CA is only created once a certificate is needed
+	caDir := config.CADir
+	if caDir == "" {
+		caDir = defaultCADir()
+	}
+
 	s := &Server{
 		config:     config,
 		logger:     logger,
 		repository: repository,
 		renderer:   renderer,
+		ca:         util.NewLocalCA(caDir),
 	}
 
 	// Create router
@@ -137,7 +163,7 @@ func (s *Server) createRouter() http.Handler {
 	router := mux.NewRouter()
 
 	// Create controllers
-	impostersController := controllers.NewImpostersController(s.repository, s.renderer, s.logger, s.config.AllowInjection, s.config.Debug)
+	impostersController := controllers.NewImpostersController(s.repository, s.renderer, s.logger, s.config.AllowInjection, s.config.Debug, s.ca, s.config.BodyRoot, s.config.InjectionTimeout, s.config.ModulesDir)
 	imposterController := controllers.NewImposterController(s.repository, s.logger, s.renderer)
 	logsController := controllers.NewLogsController(s.logger, s.renderer)
 
@@ -158,14 +184,33 @@ func (s *Server) createRouter() http.Handler {
 	router.HandleFunc("/imposters", impostersController.Post).Methods("POST")
 	router.HandleFunc("/imposters", impostersController.Delete).Methods("DELETE")
 	router.HandleFunc("/imposters", impostersController.Put).Methods("PUT")
+	router.HandleFunc("/state", impostersController.GetState).Methods("GET")
+	router.HandleFunc("/state", impostersController.PutState).Methods("PUT")
+	router.HandleFunc("/state", impostersController.DeleteState).Methods("DELETE")
 
 	router.HandleFunc("/imposters/{id}", imposterController.Get).Methods("GET")
 	router.HandleFunc("/imposters/{id}", imposterController.Delete).Methods("DELETE")
 	router.HandleFunc("/imposters/{id}/stubs", imposterController.PutStubs).Methods("PUT")
 	router.HandleFunc("/imposters/{id}/stubs", imposterController.PostStub).Methods("POST")
-	router.HandleFunc("/imposters/{id}/stubs/{stubIndex}", imposterController.PutStub).Methods("PUT")
-	router.HandleFunc("/imposters/{id}/stubs/{stubIndex}", imposterController.DeleteStub).Methods("DELETE")
+	router.HandleFunc("/imposters/{id}/stubs/enable", imposterController.EnableStubs).Methods("POST")
+	router.HandleFunc("/imposters/{id}/stubs/disable", imposterController.DisableStubs).Methods("POST")
+	router.HandleFunc("/imposters/{id}/stubs/{stubId}", imposterController.GetStub).Methods("GET")
+	router.HandleFunc("/imposters/{id}/stubs/{stubId}", imposterController.PutStub).Methods("PUT")
+	router.HandleFunc("/imposters/{id}/stubs/{stubId}", imposterController.PatchStub).Methods("PATCH")
+	router.HandleFunc("/imposters/{id}/stubs/{stubId}", imposterController.DeleteStub).Methods("DELETE")
+	router.HandleFunc("/imposters/{id}/stubs/{stubId}/move", imposterController.MoveStub).Methods("POST")
+	router.HandleFunc("/imposters/{id}/stubs/{stubId}/enable", imposterController.EnableStub).Methods("POST")
+	router.HandleFunc("/imposters/{id}/stubs/{stubId}/disable", imposterController.DisableStub).Methods("POST")
 	router.HandleFunc("/imposters/{id}/savedRequests", imposterController.ResetRequests).Methods("DELETE")
+	router.HandleFunc("/imposters/{id}/callbacks", imposterController.GetCallbacks).Methods("GET")
+	router.HandleFunc("/imposters/{id}/callbacks", imposterController.ResetCallbacks).Methods("DELETE")
+	router.HandleFunc("/imposters/{id}/scenarios", imposterController.GetScenarios).Methods("GET")
+	router.HandleFunc("/imposters/{id}/scenarios", imposterController.ResetScenarios).Methods("DELETE")
+	router.HandleFunc("/imposters/{id}/scenarios/{name}", imposterController.GetScenario).Methods("GET")
+	router.HandleFunc("/imposters/{id}/scenarios/{name}", imposterController.ResetScenario).Methods("DELETE")
+	router.HandleFunc("/imposters/{id}/state", imposterController.GetState).Methods("GET")
+	router.HandleFunc("/imposters/{id}/state", imposterController.PutState).Methods("PUT")
+	router.HandleFunc("/imposters/{id}/state", imposterController.DeleteState).Methods("DELETE")
 	router.HandleFunc("/imposters/{id}/savedProxyResponses", imposterController.DeleteSavedProxyResponses).Methods("DELETE")
 	router.HandleFunc("/imposters/{id}/_requests", imposterController.PostRequest).Methods("POST")
 	// router.HandleFunc("/imposters/{id}/_requests/{proxyResolutionKey}", imposterController.PostProxyResponse).Methods("POST")
@@ -173,6 +218,7 @@ func (s *Server) createRouter() http.Handler {
 
 	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
 	router.HandleFunc("/config", s.handleConfig).Methods("GET")
+	router.HandleFunc("/ca.pem", s.handleCACert).Methods("GET")
 
 	// Static assets
 	publicFS, _ := fs.Sub(web.GetAssets(), "public")
@@ -189,7 +235,7 @@ func (s *Server) createRouter() http.Handler {
 	}
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins: allowedOrigins,
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
 	})
 
@@ -309,7 +355,13 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 			},
 			"origin":      s.config.Origin,
 			"datadir":     s.config.Datadir,
+			"caDir":       s.ca.Dir(),
+			"bodyRoot":    s.config.BodyRoot,
 			"ipWhitelist": s.config.IPWhitelist,
+
+			"injectionTimeout": s.config.InjectionTimeout,
+			"modulesDir":       s.config.ModulesDir,
+			"persistState":     s.config.PersistState,
 		},
 		"process": map[string]interface{}{
 			"nodeVersion":  runtime.Version(), // Using Go version as nodeVersion for template compatibility
@@ -339,6 +391,29 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(config)
 }
 
+// handleCACert returns the local CA certificate so clients can trust the
+// certificates minted for imposters
+func (s *Server) handleCACert(w http.ResponseWriter, r *http.Request) {
+	ca, err := s.ca.Get()
+	if err != nil {
+		s.logger.Errorf("Failed to load local CA: %v", err)
+		util.WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(ca.CertPEM())
+}
+
+// defaultCADir returns the directory the local CA is persisted in by default
+func defaultCADir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".mountebank", "ca")
+	}
+	return filepath.Join(home, ".mountebank", "ca")
+}
+
 // handleFeed handles the feed endpoint
 func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
 	host := r.Host
@@ -566,6 +641,14 @@ func (s *Server) Repository() *models.ImposterRepository {
 func (s *Server) CreateImposter(config *models.ImposterConfig) error {
 	// Create logger for this imposter
 	logger := s.logger.WithScope(fmt.Sprintf("%s:%d", config.Protocol, config.Port))
+	config.BodyRoot = s.config.BodyRoot
+	config.DefaultInjectionTimeout = s.config.InjectionTimeout
+	config.ModulesDir = s.config.ModulesDir
+	config.StateStore = s.repository.State()
+
+	if err := config.Validate(); err != nil {
+		return err
+	}
 
 	var imposter *models.Imposter
 	var err error
@@ -603,7 +686,7 @@ func (s *Server) createHTTPImposter(config *models.ImposterConfig, logger *util.
 
 	// Create HTTP server
 	// We need to import httpproto
-	server, err := httpproto.Create(config, logger, func(request *models.Request, details map[string]interface{}) (*models.Response, error) {
+	server, err := httpproto.Create(config, logger, s.ca, func(request *models.Request, details map[string]interface{}) (*models.Response, error) {
 		return imposter.GetResponseFor(request, details)
 	})
 	if err != nil {
@@ -0,0 +1,291 @@
+package util
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leafValidity is how long minted leaf certificates are valid
+const leafValidity = 365 * 24 * time.Hour
+
+// maxCachedLeaves bounds how many minted leaf certificates are kept. Clients
+// choose the server name, so the least recently used are dropped beyond it.
+const maxCachedLeaves = 256
+
+// Files used to persist the local CA
+const (
+	caCertFile = "mb-ca-cert.pem"
+	caKeyFile  = "mb-ca-key.pem"
+)
+
+// CertificateAuthority mints leaf certificates signed by a CA certificate
+type CertificateAuthority struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+	keyPEM  []byte
+
+	mu     sync.Mutex
+	leaves map[string]*list.Element
+	order  *list.List
+}
+
+// cachedLeaf is a minted certificate in the least recently used order
+type cachedLeaf struct {
+	host string
+	cert *tls.Certificate
+}
+
+// NewCertificateAuthority generates a new self-signed CA
+func NewCertificateAuthority(commonName string) (*CertificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"mountebank"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertificateAuthority{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		leaves:  make(map[string]*list.Element),
+		order:   list.New(),
+	}, nil
+}
+
+// LoadCertificateAuthority loads a CA from PEM encoded certificate and key
+func LoadCertificateAuthority(certPEM, keyPEM []byte) (*CertificateAuthority, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA key pair: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %s is not a CA", cert.Subject.CommonName)
+	}
+
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA private key type %T", pair.PrivateKey)
+	}
+
+	return &CertificateAuthority{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		keyPEM:  keyPEM,
+		leaves:  make(map[string]*list.Element),
+		order:   list.New(),
+	}, nil
+}
+
+// LoadOrCreateCertificateAuthority loads the CA persisted in a directory,
+// creating and saving a new one on first use
+func LoadOrCreateCertificateAuthority(dir string) (*CertificateAuthority, error) {
+	certPath := filepath.Join(dir, caCertFile)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	if certErr == nil && keyErr == nil {
+		return LoadCertificateAuthority(certPEM, keyPEM)
+	}
+	if !os.IsNotExist(certErr) && certErr != nil {
+		return nil, certErr
+	}
+	if !os.IsNotExist(keyErr) && keyErr != nil {
+		return nil, keyErr
+	}
+
+	ca, err := NewCertificateAuthority("mountebank local CA")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA: %v", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create CA directory: %v", err)
+	}
+	if err := os.WriteFile(keyPath, ca.keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save CA key: %v", err)
+	}
+	if err := os.WriteFile(certPath, ca.certPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save CA certificate: %v", err)
+	}
+
+	return ca, nil
+}
+
+// CertPEM returns the PEM encoded CA certificate
+func (ca *CertificateAuthority) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// CertificateFor returns a leaf certificate for the host, minting and caching
+// it on first use. Hosts may include a port, which is ignored. Only the most
+// recently used certificates are cached.
+func (ca *CertificateAuthority) CertificateFor(host string) (*tls.Certificate, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "" {
+		host = "localhost"
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if element, ok := ca.leaves[host]; ok {
+		ca.order.MoveToFront(element)
+		return element.Value.(*cachedLeaf).cert, nil
+	}
+
+	leaf, err := ca.mint(host)
+	if err != nil {
+		return nil, err
+	}
+	ca.leaves[host] = ca.order.PushFront(&cachedLeaf{host: host, cert: leaf})
+	if ca.order.Len() > maxCachedLeaves {
+		oldest := ca.order.Back()
+		ca.order.Remove(oldest)
+		delete(ca.leaves, oldest.Value.(*cachedLeaf).host)
+	}
+	return leaf, nil
+}
+
+// mint creates a leaf certificate for a single host name or IP address
+func (ca *CertificateAuthority) mint(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host, Organization: []string{"mountebank"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mint certificate for %s: %v", host, err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+// LocalCA lazily loads the CA persisted in a directory, so that nothing is
+// written to disk until a certificate is actually needed
+type LocalCA struct {
+	dir string
+	mu  sync.Mutex
+	ca  *CertificateAuthority
+}
+
+// NewLocalCA creates a local CA persisted in dir
+func NewLocalCA(dir string) *LocalCA {
+	return &LocalCA{dir: dir}
+}
+
+// Get returns the CA, loading or creating it on first use
+func (l *LocalCA) Get() (*CertificateAuthority, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ca == nil {
+		ca, err := LoadOrCreateCertificateAuthority(l.dir)
+		if err != nil {
+			return nil, err
+		}
+		l.ca = ca
+	}
+	return l.ca, nil
+}
+
+// Dir returns the directory the CA is persisted in
+func (l *LocalCA) Dir() string {
+	return l.dir
+}
+
+// LoadPEM returns PEM data given either inline or as a path to a PEM file
+func LoadPEM(value string) ([]byte, error) {
+	if value == "" || strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PEM file: %v", err)
+	}
+	return data, nil
+}
+
+// newSerialNumber returns a random 128-bit certificate serial number
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
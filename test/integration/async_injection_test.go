@@ -0,0 +1,224 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestAsyncInjection(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:           2555,
+		Host:           "localhost",
+		LogLevel:       "error",
+		IPWhitelist:    []string{"*"},
+		AllowInjection: true,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	stub := func(path string, response map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{response},
+		}
+	}
+	inject := func(path, fn string) map[string]interface{} {
+		return stub(path, map[string]interface{}{"inject": fn})
+	}
+
+	imposter := map[string]interface{}{
+		"protocol":         "http",
+		"port":             4580,
+		"injectionTimeout": 500,
+		"stubs": []map[string]interface{}{
+			inject("/callback", "function (config) { setTimeout(function () { config.callback({ body: 'later' }); }, 20); }"),
+			inject("/legacy", "function (request, state, logger, callback) { callback({ body: 'legacy' }); }"),
+			inject("/promise", "function (config) { return new Promise(function (resolve) { setTimeout(function () { resolve({ body: 'promised' }); }, 10); }); }"),
+			inject("/rejected", "function (config) { return Promise.reject(new Error('nope')); }"),
+			inject("/unresolved", "function (config) { return new Promise(function () {}); }"),
+			inject("/slow", "function (config) { setTimeout(function () { config.callback({ body: 'too late' }); }, 5000); }"),
+			stub("/decorate", map[string]interface{}{
+				"is": map[string]interface{}{"body": "plain"},
+				"behaviors": []map[string]interface{}{
+					{"decorate": "function (config) { return new Promise(function (resolve) { setTimeout(function () { config.response.body = 'decorated'; resolve(); }, 10); }); }"},
+				},
+			}),
+			{
+				"predicates": []map[string]interface{}{
+					{"inject": "function (config) { return Promise.resolve(config.request.path === '/predicate'); }"},
+				},
+				"responses": []map[string]interface{}{
+					{"is": map[string]interface{}{"body": "matched"}},
+				},
+			},
+		},
+	}
+	payload, _ := json.Marshal(imposter)
+	resp, err := http.Post("http://localhost:2555/imposters", "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/callback", http.StatusOK, "later"},
+		{"/legacy", http.StatusOK, "legacy"},
+		{"/promise", http.StatusOK, "promised"},
+		{"/decorate", http.StatusOK, "decorated"},
+		{"/predicate", http.StatusOK, "matched"},
+		{"/rejected", http.StatusInternalServerError, "injection execution failed: promise rejected: Error: nope"},
+		{"/unresolved", http.StatusInternalServerError, "injection execution failed: script never resolved its promise or called callback"},
+		{"/slow", http.StatusInternalServerError, "injection execution failed: timeout"},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		resp, err := http.Get("http://localhost:4580" + tt.path)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", tt.path, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status || string(data) != tt.body {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.path, tt.status, tt.body, resp.StatusCode, data)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: took %v", tt.path, elapsed)
+		}
+	}
+}
+
+func TestAsyncRepository(t *testing.T) {
+	// A custom repository whose functions return promises
+	repo := filepath.Join(t.TempDir(), "repository.js")
+	source := `
+module.exports = {
+	create: function (config) {
+		var imposters = [{
+			protocol: 'http',
+			port: 4581,
+			stubs: [{ responses: [{ is: { body: 'from repository' } }] }]
+		}];
+		return {
+			load: function () {
+				return new Promise(function (resolve) {
+					setTimeout(function () { resolve(imposters); }, 10);
+				});
+			},
+			add: function (imposter) { return Promise.resolve(imposter); },
+			del: function (port) { return Promise.resolve(); },
+			deleteAll: function () { return Promise.resolve(); }
+		};
+	}
+};
+`
+	if err := os.WriteFile(repo, []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write repository: %v", err)
+	}
+
+	config := &server.Config{
+		Port:          2556,
+		Host:          "localhost",
+		LogLevel:      "error",
+		IPWhitelist:   []string{"*"},
+		ImpostersRepo: repo,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Imposters resolved from the promise are started
+	resp, err := http.Get("http://localhost:4581/")
+	if err != nil {
+		t.Fatalf("Failed to call loaded imposter: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(data), "from repository") {
+		t.Errorf("Expected loaded imposter response, got %q", data)
+	}
+}
+
+func TestAsyncRepositoryTimeout(t *testing.T) {
+	// A custom repository whose load promise never settles
+	repo := filepath.Join(t.TempDir(), "repository.js")
+	source := `
+module.exports = {
+	create: function (config) {
+		return {
+			load: function () {
+				return new Promise(function (resolve) {
+					setTimeout(function () { resolve([]); }, 60000);
+				});
+			},
+			add: function (imposter) { return Promise.resolve(imposter); },
+			del: function (port) { return Promise.resolve(); },
+			deleteAll: function () { return Promise.resolve(); }
+		};
+	}
+};
+`
+	if err := os.WriteFile(repo, []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write repository: %v", err)
+	}
+
+	config := &server.Config{
+		Port:             2560,
+		Host:             "localhost",
+		LogLevel:         "error",
+		IPWhitelist:      []string{"*"},
+		ImpostersRepo:    repo,
+		InjectionTimeout: 200,
+	}
+
+	// Loading gives up after the injection timeout instead of hanging
+	start := time.Now()
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected repository load to time out, took %v", elapsed)
+	}
+	srv.Stop()
+}
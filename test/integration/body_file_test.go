@@ -0,0 +1,137 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestBodyFile(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "fixtures"), 0755)
+	os.WriteFile(filepath.Join(root, "fixtures", "users.json"), []byte(`{"users": ["alice"]}`), 0644)
+	binary := bytes.Repeat([]byte{0x89, 'P', 'N', 'G', 0x00, 0xff}, 100000)
+	os.WriteFile(filepath.Join(root, "logo.png"), binary, 0644)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("secret"), 0644)
+	if err := os.Symlink(outside, filepath.Join(root, "link.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2547,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+		BodyRoot:    root,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	stub := func(path, bodyFile string, behaviors []map[string]interface{}) map[string]interface{} {
+		response := map[string]interface{}{"is": map[string]interface{}{"bodyFile": bodyFile}}
+		if behaviors != nil {
+			response["behaviors"] = behaviors
+		}
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{response},
+		}
+	}
+
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4569,
+		"stubs": []map[string]interface{}{
+			stub("/users", "fixtures/users.json", nil),
+			stub("/logo", "logo.png", nil),
+			stub("/copy", "fixtures/users.json", []map[string]interface{}{
+				{"copy": map[string]interface{}{"from": "query.name", "into": "alice"}},
+			}),
+			stub("/escape", "../outside.txt", nil),
+			stub("/symlink", "link.txt", nil),
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2547/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	get := func(path string) (*http.Response, []byte) {
+		res, err := http.Get("http://localhost:4569" + path)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", path, err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return res, data
+	}
+
+	// Content type is inferred from the extension
+	res, data := get("/users")
+	if string(data) != `{"users": ["alice"]}` {
+		t.Errorf("Expected JSON fixture, got '%s'", data)
+	}
+	if contentType := res.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected application/json, got '%s'", contentType)
+	}
+
+	// Binary files arrive intact with their length
+	res, data = get("/logo")
+	if !bytes.Equal(data, binary) {
+		t.Errorf("Expected binary file of %d bytes, got %d bytes", len(binary), len(data))
+	}
+	if res.Header.Get("Content-Type") != "image/png" || res.ContentLength != int64(len(binary)) {
+		t.Errorf("Unexpected binary headers: %v", res.Header)
+	}
+
+	// Behaviors see the file contents
+	if _, data = get("/copy?name=bob"); string(data) != `{"users": ["bob"]}` {
+		t.Errorf("Expected copy behavior to apply to file contents, got '%s'", data)
+	}
+
+	// Changes to the file are picked up
+	os.WriteFile(filepath.Join(root, "fixtures", "users.json"), []byte(`{"users": ["alice", "carol"]}`), 0644)
+	if _, data = get("/users"); string(data) != `{"users": ["alice", "carol"]}` {
+		t.Errorf("Expected updated fixture, got '%s'", data)
+	}
+	if _, data = get("/copy?name=bob"); string(data) != `{"users": ["bob", "carol"]}` {
+		t.Errorf("Expected behaviors to see updated fixture, got '%s'", data)
+	}
+
+	// Files outside the root are refused
+	if res, _ = get("/escape"); res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected files outside the root to be refused, got %d", res.StatusCode)
+	}
+	if res, data = get("/symlink"); res.StatusCode != http.StatusInternalServerError || string(data) == "secret" {
+		t.Errorf("Expected symlinks out of the root to be refused, got %d '%s'", res.StatusCode, data)
+	}
+}
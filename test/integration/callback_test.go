@@ -0,0 +1,159 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestCallbackBehavior(t *testing.T) {
+	// Webhook receiver failing the first attempt
+	var mu sync.Mutex
+	var received []string
+	var headers []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(body))
+		headers = append(headers, r.Header.Get("X-Signature"))
+		if len(received) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer webhook.Close()
+
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2549,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4571,
+		"stubs": []map[string]interface{}{
+			{
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{"statusCode": 202, "body": "accepted"},
+						"behaviors": []map[string]interface{}{
+							{"callback": map[string]interface{}{
+								"url":        webhook.URL + "/webhooks/{{.request.json.id}}",
+								"headers":    map[string]interface{}{"X-Signature": "sig-{{.request.json.id}}"},
+								"body":       map[string]interface{}{"paymentId": "{{.request.json.id}}", "status": "settled"},
+								"delay":      200,
+								"retries":    2,
+								"retryDelay": 50,
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2549/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	res, err := http.Post("http://localhost:4571/payments", "application/json", bytes.NewBufferString(`{"id": "pay-1"}`))
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 202 {
+		t.Errorf("Expected status 202, got %d", res.StatusCode)
+	}
+
+	// The callback is delayed until after the response
+	mu.Lock()
+	early := len(received)
+	mu.Unlock()
+	if early != 0 {
+		t.Errorf("Expected callback to be delayed, got %d already", early)
+	}
+
+	// Wait for the retried callback to be recorded
+	var callbacks struct {
+		Callbacks []struct {
+			Method     string `json:"method"`
+			URL        string `json:"url"`
+			Body       string `json:"body"`
+			Attempts   int    `json:"attempts"`
+			StatusCode int    `json:"statusCode"`
+		} `json:"callbacks"`
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && len(callbacks.Callbacks) == 0 {
+		time.Sleep(50 * time.Millisecond)
+		getResp, err := http.Get("http://localhost:2549/imposters/4571/callbacks")
+		if err != nil {
+			t.Fatalf("Failed to get callbacks: %v", err)
+		}
+		json.NewDecoder(getResp.Body).Decode(&callbacks)
+		getResp.Body.Close()
+	}
+
+	if len(callbacks.Callbacks) != 1 {
+		t.Fatalf("Expected one recorded callback, got %+v", callbacks)
+	}
+	callback := callbacks.Callbacks[0]
+	if callback.Method != "POST" || callback.URL != webhook.URL+"/webhooks/pay-1" || callback.Attempts != 2 || callback.StatusCode != 200 {
+		t.Errorf("Unexpected callback record: %+v", callback)
+	}
+
+	mu.Lock()
+	if len(received) != 2 || received[1] != `{"paymentId":"pay-1","status":"settled"}` || headers[1] != "sig-pay-1" {
+		t.Errorf("Unexpected webhook requests: %v %v", received, headers)
+	}
+	mu.Unlock()
+
+	// Deleting saved requests forgets the callbacks too
+	req, _ := http.NewRequest("DELETE", "http://localhost:2549/imposters/4571/savedRequests", nil)
+	deleteResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to delete saved requests: %v", err)
+	}
+	deleteResp.Body.Close()
+
+	getResp, err := http.Get("http://localhost:2549/imposters/4571/callbacks")
+	if err != nil {
+		t.Fatalf("Failed to get callbacks: %v", err)
+	}
+	defer getResp.Body.Close()
+	callbacks.Callbacks = nil
+	json.NewDecoder(getResp.Body).Decode(&callbacks)
+	if len(callbacks.Callbacks) != 0 {
+		t.Errorf("Expected callbacks to be cleared with saved requests, got %+v", callbacks)
+	}
+}
@@ -0,0 +1,190 @@
+package integration
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	httpproto "github.com/mountebank-testing/mountebank-go/internal/protocols/http"
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestCompression(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2535,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Create imposter that negotiates compression
+	imposterConfig := map[string]interface{}{
+		"protocol":          "http",
+		"port":              4556,
+		"compressResponses": true,
+		"recordRequests":    true,
+		"defaultResponse": map[string]interface{}{
+			"statusCode": 404,
+		},
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"body": map[string]interface{}{
+								"device": "mobile",
+							},
+						},
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode":  200,
+							"body":        "compressed by request",
+							"compression": "gzip",
+						},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"path": "/negotiated",
+						},
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 200,
+							"body":       "compressed by negotiation",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2535/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Send a gzip encoded request body
+	var gzBody bytes.Buffer
+	gz := gzip.NewWriter(&gzBody)
+	gz.Write([]byte(`{"device": "mobile"}`))
+	gz.Close()
+
+	req, _ := http.NewRequest("POST", "http://localhost:4556/sync", &gzBody)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "identity")
+
+	// Use a transport that doesn't transparently decompress
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	testResp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	defer testResp.Body.Close()
+
+	if testResp.StatusCode != 200 {
+		t.Fatalf("Expected status 200 for gzip request, got %d", testResp.StatusCode)
+	}
+	if testResp.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected Content-Encoding gzip, got '%s'", testResp.Header.Get("Content-Encoding"))
+	}
+	gzReader, err := gzip.NewReader(testResp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read gzip response: %v", err)
+	}
+	respBody, _ := io.ReadAll(gzReader)
+	if string(respBody) != "compressed by request" {
+		t.Errorf("Expected body 'compressed by request', got '%s'", string(respBody))
+	}
+
+	// The recorded request holds the decoded body, so drops its coding
+	imposterResp, err := http.Get("http://localhost:2535/imposters/4556")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	var recorded struct {
+		Requests []struct {
+			Headers map[string]interface{} `json:"headers"`
+		} `json:"requests"`
+	}
+	json.NewDecoder(imposterResp.Body).Decode(&recorded)
+	imposterResp.Body.Close()
+	if len(recorded.Requests) != 1 {
+		t.Fatalf("Expected 1 recorded request, got %d", len(recorded.Requests))
+	}
+	if _, ok := recorded.Requests[0].Headers["Content-Encoding"]; ok {
+		t.Errorf("Expected Content-Encoding to be dropped from the decoded request, got %v", recorded.Requests[0].Headers)
+	}
+
+	// A body expanding past the limit is refused
+	var bomb bytes.Buffer
+	gzBomb, _ := gzip.NewWriterLevel(&bomb, gzip.BestCompression)
+	gzBomb.Write(make([]byte, httpproto.MaxDecodedBodySize+1))
+	gzBomb.Close()
+
+	bombReq, _ := http.NewRequest("POST", "http://localhost:4556/bomb", &bomb)
+	bombReq.Header.Set("Content-Encoding", "gzip")
+	bombResp, err := client.Do(bombReq)
+	if err != nil {
+		t.Fatalf("Failed to send compressed request: %v", err)
+	}
+	bombResp.Body.Close()
+	if bombResp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized decoded body, got %d", bombResp.StatusCode)
+	}
+
+	// Negotiate brotli through Accept-Encoding
+	req2, _ := http.NewRequest("GET", "http://localhost:4556/negotiated", nil)
+	req2.Header.Set("Accept-Encoding", "gzip;q=0.5, br")
+	testResp2, err := client.Do(req2)
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	defer testResp2.Body.Close()
+
+	if testResp2.Header.Get("Content-Encoding") != "br" {
+		t.Errorf("Expected Content-Encoding br, got '%s'", testResp2.Header.Get("Content-Encoding"))
+	}
+	raw, _ := io.ReadAll(testResp2.Body)
+	if testResp2.ContentLength != int64(len(raw)) {
+		t.Errorf("Expected Content-Length %d, got %d", len(raw), testResp2.ContentLength)
+	}
+	respBody2, _ := io.ReadAll(brotli.NewReader(bytes.NewReader(raw)))
+	if string(respBody2) != "compressed by negotiation" {
+		t.Errorf("Expected body 'compressed by negotiation', got '%s'", string(respBody2))
+	}
+}
@@ -0,0 +1,177 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestCookies(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2536,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Create imposter that logs in and checks the session cookie
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4557,
+		"defaultResponse": map[string]interface{}{
+			"statusCode": 401,
+		},
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"path": "/login",
+						},
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 200,
+							"headers": map[string]interface{}{
+								"Set-Cookie": []string{"theme=dark", "lang=en"},
+							},
+							"cookies": []map[string]interface{}{
+								{
+									"name":     "session",
+									"value":    "abc123",
+									"path":     "/",
+									"httpOnly": true,
+									"secure":   true,
+									"sameSite": "Strict",
+									"maxAge":   3600,
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"cookies": map[string]interface{}{
+								"session": "abc123",
+							},
+						},
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 200,
+							"body":       "Session ${SESSION}",
+						},
+						"behaviors": []map[string]interface{}{
+							{
+								"copy": map[string]interface{}{
+									"from": "cookies.session",
+									"into": "${SESSION}",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2536/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Login sets every cookie on its own header line
+	testResp, err := http.Get("http://localhost:4557/login")
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	defer testResp.Body.Close()
+
+	setCookies := testResp.Header.Values("Set-Cookie")
+	if len(setCookies) != 3 {
+		t.Fatalf("Expected 3 Set-Cookie headers, got %d: %v", len(setCookies), setCookies)
+	}
+	session := setCookies[2]
+	for _, attr := range []string{"session=abc123", "Path=/", "Max-Age=3600", "HttpOnly", "Secure", "SameSite=Strict"} {
+		if !strings.Contains(session, attr) {
+			t.Errorf("Expected session cookie to contain '%s', got '%s'", attr, session)
+		}
+	}
+
+	// Session cookie is available to predicates and copy
+	req, _ := http.NewRequest("GET", "http://localhost:4557/profile", nil)
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+	testResp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	defer testResp2.Body.Close()
+
+	if testResp2.StatusCode != 200 {
+		t.Errorf("Expected status 200 with session cookie, got %d", testResp2.StatusCode)
+	}
+	respBody, _ := io.ReadAll(testResp2.Body)
+	if string(respBody) != "Session abc123" {
+		t.Errorf("Expected body 'Session abc123', got '%s'", string(respBody))
+	}
+
+	// Invalid cookie attributes are rejected when the imposter is created
+	for _, cookie := range []map[string]interface{}{
+		{"name": "session", "value": "abc123", "sameSite": "sometimes"},
+		{"name": "session", "value": "abc123", "expires": "next tuesday"},
+	} {
+		invalid := map[string]interface{}{
+			"protocol": "http",
+			"stubs": []map[string]interface{}{
+				{
+					"responses": []map[string]interface{}{
+						{"is": map[string]interface{}{"cookies": []map[string]interface{}{cookie}}},
+					},
+				},
+			},
+		}
+		body, _ := json.Marshal(invalid)
+		resp, err := http.Post("http://localhost:2536/imposters", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Failed to create imposter: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for cookie %v, got %d", cookie, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestFakerBehavior(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:           2546,
+		Host:           "localhost",
+		LogLevel:       "error",
+		AllowInjection: true,
+		IPWhitelist:    []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4568,
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/seeded"}},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{"body": "${NAME}|${IBAN}|${DATE}"},
+						"behaviors": []map[string]interface{}{
+							{"faker": map[string]interface{}{
+								"seed": 7,
+								"into": map[string]interface{}{
+									"${NAME}": "name",
+									"${IBAN}": map[string]interface{}{"type": "iban", "country": "GB"},
+									"${DATE}": map[string]interface{}{"type": "date", "from": "2020-01-01", "to": "2020-12-31"},
+								},
+							}},
+						},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/decorate"}},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{"body": ""},
+						"behaviors": []map[string]interface{}{
+							{"decorate": "function (config) { faker.seed(3); config.response.body = faker.email() + '|' + faker.number(5, 5); }"},
+						},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/template"}},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is":        map[string]interface{}{"body": "{{fake \"email\"}}"},
+						"behaviors": []map[string]interface{}{{"template": true}},
+					},
+				},
+			},
+		},
+	}
+
+	createImposter := func() {
+		body, _ := json.Marshal(imposterConfig)
+		resp, err := http.Post("http://localhost:2546/imposters", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Failed to create imposter: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+		}
+	}
+
+	get := func(path string) string {
+		res, err := http.Get("http://localhost:4568" + path)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", path, err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return string(data)
+	}
+
+	createImposter()
+	first, second := get("/seeded"), get("/seeded")
+	if first == second {
+		t.Errorf("Expected seeded values to vary between responses, got '%s' twice", first)
+	}
+
+	parts := strings.Split(first, "|")
+	if len(parts) != 3 || strings.Contains(first, "${") {
+		t.Fatalf("Expected all tokens to be replaced, got '%s'", first)
+	}
+	if !regexp.MustCompile(`^GB\d{2}[A-Z]{4}\d{14}$`).MatchString(parts[1]) || !validIBAN(parts[1]) {
+		t.Errorf("Expected valid GB IBAN, got '%s'", parts[1])
+	}
+	if !strings.HasPrefix(parts[2], "2020-") {
+		t.Errorf("Expected date in 2020, got '%s'", parts[2])
+	}
+
+	// Recreating the imposter replays the same sequence
+	req, _ := http.NewRequest("DELETE", "http://localhost:2546/imposters/4568", nil)
+	if res, err := http.DefaultClient.Do(req); err == nil {
+		res.Body.Close()
+	}
+	createImposter()
+	if replay := get("/seeded"); replay != first {
+		t.Errorf("Expected seeded sequence to repeat, got '%s' then '%s'", first, replay)
+	}
+
+	// Scripts can use a seeded faker object
+	decorated := get("/decorate")
+	if decorated != get("/decorate") || !regexp.MustCompile(`^[a-zü.]+\d+@[a-z.]+\|5$`).MatchString(decorated) {
+		t.Errorf("Expected reproducible email from decorate, got '%s'", decorated)
+	}
+
+	if email := get("/template"); !strings.Contains(email, "@") {
+		t.Errorf("Expected email from template helper, got '%s'", email)
+	}
+
+	// Unknown generators are rejected when the imposter is created
+	invalid, _ := json.Marshal(map[string]interface{}{
+		"protocol": "http",
+		"port":     4590,
+		"stubs": []map[string]interface{}{
+			{
+				"responses": []map[string]interface{}{
+					{
+						"is":        map[string]interface{}{"body": "${X}"},
+						"behaviors": []map[string]interface{}{{"faker": map[string]interface{}{"into": map[string]interface{}{"${X}": "bogus"}}}},
+					},
+				},
+			},
+		},
+	})
+	resp, err := http.Post("http://localhost:2546/imposters", "application/json", bytes.NewBuffer(invalid))
+	if err != nil {
+		t.Fatalf("Failed to post imposter: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown generator, got %d", resp.StatusCode)
+	}
+}
+
+// validIBAN checks the ISO 13616 checksum
+func validIBAN(iban string) bool {
+	rearranged := iban[4:] + iban[:4]
+	var digits strings.Builder
+	for _, c := range rearranged {
+		if c >= 'A' && c <= 'Z' {
+			digits.WriteString(big.NewInt(int64(c - 'A' + 10)).String())
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
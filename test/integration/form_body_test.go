@@ -0,0 +1,153 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestFormBodyParsing(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2534,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Create imposter matching on form fields and uploads
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4555,
+		"defaultResponse": map[string]interface{}{
+			"statusCode": 404,
+		},
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"body": map[string]interface{}{
+								"username": "alice",
+							},
+						},
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 200,
+							"body":       "Welcome ${USER}",
+						},
+						"behaviors": []map[string]interface{}{
+							{
+								"copy": map[string]interface{}{
+									"from": "body.username",
+									"into": "${USER}",
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"body": map[string]interface{}{
+								"document": map[string]interface{}{
+									"filename": "report.csv",
+									"content":  "a,b,c",
+								},
+							},
+						},
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 201,
+							"body":       "Uploaded ${NAME}",
+						},
+						"behaviors": []map[string]interface{}{
+							{
+								"copy": map[string]interface{}{
+									"from": "body.document.filename",
+									"into": "${NAME}",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2534/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Test urlencoded form
+	testResp, err := http.PostForm("http://localhost:4555/login", url.Values{"username": {"alice"}, "password": {"secret"}})
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	defer testResp.Body.Close()
+
+	if testResp.StatusCode != 200 {
+		t.Errorf("Expected status 200 for form post, got %d", testResp.StatusCode)
+	}
+	respBody, _ := io.ReadAll(testResp.Body)
+	if string(respBody) != "Welcome alice" {
+		t.Errorf("Expected body 'Welcome alice', got '%s'", string(respBody))
+	}
+
+	// Test multipart upload
+	var upload bytes.Buffer
+	writer := multipart.NewWriter(&upload)
+	writer.WriteField("description", "quarterly")
+	part, _ := writer.CreateFormFile("document", "report.csv")
+	part.Write([]byte("a,b,c"))
+	writer.Close()
+
+	testResp2, err := http.Post("http://localhost:4555/upload", writer.FormDataContentType(), &upload)
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	defer testResp2.Body.Close()
+
+	if testResp2.StatusCode != 201 {
+		t.Errorf("Expected status 201 for multipart upload, got %d", testResp2.StatusCode)
+	}
+	respBody2, _ := io.ReadAll(testResp2.Body)
+	if string(respBody2) != "Uploaded report.csv" {
+		t.Errorf("Expected body 'Uploaded report.csv', got '%s'", string(respBody2))
+	}
+}
@@ -0,0 +1,226 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestForwardProxy(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2538,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+		CADir:       t.TempDir(),
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Create imposter that intercepts TLS and stubs several upstream hosts
+	imposterConfig := map[string]interface{}{
+		"protocol":       "http",
+		"port":           4559,
+		"recordRequests": true,
+		"forwardProxy": map[string]interface{}{
+			"interceptTLS": true,
+		},
+		"defaultResponse": map[string]interface{}{
+			"statusCode": 404,
+		},
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"host": "api.example.test",
+							"path": "/users",
+						},
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 200,
+							"body":       "secure users",
+						},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"host": "legacy.example.test",
+						},
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 200,
+							"body":       "plain legacy",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2538/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	proxyURL, _ := url.Parse("http://localhost:4559")
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	// HTTPS requests are intercepted through a CONNECT tunnel
+	testResp, err := client.Get("https://api.example.test/users")
+	if err != nil {
+		t.Fatalf("Failed to call through proxy: %v", err)
+	}
+	defer testResp.Body.Close()
+
+	respBody, _ := io.ReadAll(testResp.Body)
+	if testResp.StatusCode != 200 || string(respBody) != "secure users" {
+		t.Errorf("Expected 200 'secure users', got %d '%s'", testResp.StatusCode, string(respBody))
+	}
+	if testResp.TLS == nil || len(testResp.TLS.PeerCertificates) == 0 {
+		t.Fatalf("Expected TLS response")
+	}
+	if names := testResp.TLS.PeerCertificates[0].DNSNames; len(names) != 1 || names[0] != "api.example.test" {
+		t.Errorf("Expected certificate minted for api.example.test, got %v", names)
+	}
+
+	// Plain HTTP requests arrive in absolute form
+	testResp2, err := client.Get("http://legacy.example.test/status")
+	if err != nil {
+		t.Fatalf("Failed to call through proxy: %v", err)
+	}
+	defer testResp2.Body.Close()
+
+	respBody2, _ := io.ReadAll(testResp2.Body)
+	if string(respBody2) != "plain legacy" {
+		t.Errorf("Expected body 'plain legacy', got '%s'", string(respBody2))
+	}
+
+	// Recorded requests carry the target host
+	getResp, err := http.Get("http://localhost:2538/imposters/4559")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	defer getResp.Body.Close()
+
+	var imposter struct {
+		Requests []struct {
+			Protocol string `json:"protocol"`
+			Host     string `json:"host"`
+			Path     string `json:"path"`
+		} `json:"requests"`
+	}
+	json.NewDecoder(getResp.Body).Decode(&imposter)
+	if len(imposter.Requests) != 2 {
+		t.Fatalf("Expected 2 recorded requests, got %d", len(imposter.Requests))
+	}
+	if r := imposter.Requests[0]; r.Protocol != "https" || r.Host != "api.example.test" || r.Path != "/users" {
+		t.Errorf("Unexpected intercepted request: %+v", r)
+	}
+	if r := imposter.Requests[1]; r.Protocol != "http" || r.Host != "legacy.example.test" {
+		t.Errorf("Unexpected absolute-form request: %+v", r)
+	}
+}
+
+func TestForwardProxyTunnel(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2539,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "from upstream")
+	}))
+	defer upstream.Close()
+
+	// Without interception, CONNECT tunnels pass through to the target
+	imposterConfig := map[string]interface{}{
+		"protocol":     "http",
+		"port":         4560,
+		"forwardProxy": map[string]interface{}{},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2539/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	proxyURL, _ := url.Parse("http://localhost:4560")
+	transport := upstream.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	client := &http.Client{Transport: transport}
+
+	testResp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Failed to call through tunnel: %v", err)
+	}
+	defer testResp.Body.Close()
+
+	respBody, _ := io.ReadAll(testResp.Body)
+	if string(respBody) != "from upstream" {
+		t.Errorf("Expected body 'from upstream', got '%s'", string(respBody))
+	}
+}
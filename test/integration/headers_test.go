@@ -0,0 +1,195 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestHeaderFidelity(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2537,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Create imposter matching one of several repeated header values
+	caseSensitive := true
+	imposterConfig := map[string]interface{}{
+		"protocol":       "http",
+		"port":           4558,
+		"recordRequests": true,
+		"defaultResponse": map[string]interface{}{
+			"statusCode": 404,
+		},
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{
+					{
+						"equals": map[string]interface{}{
+							"headers": map[string]interface{}{
+								"x-api-version": "v2",
+							},
+						},
+						"caseSensitive": caseSensitive,
+					},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 200,
+							"headers": map[string]interface{}{
+								"x-trace-ID": "abc",
+								"Link":       []string{"</a>; rel=next", "</b>; rel=prev"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2537/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Send mixed case and repeated headers over a raw connection
+	conn, err := net.Dial("tcp", "localhost:4558")
+	if err != nil {
+		t.Fatalf("Failed to connect to imposter: %v", err)
+	}
+	defer conn.Close()
+
+	fmt.Fprint(conn, "GET /versions HTTP/1.1\r\n"+
+		"host: localhost:4558\r\n"+
+		"X-API-Version: v1\r\n"+
+		"x-api-version: v2\r\n"+
+		"X-lower-UPPER: Mixed\r\n"+
+		"Connection: close\r\n"+
+		"\r\n")
+
+	rawResp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read imposter response: %v", err)
+	}
+	testResp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rawResp)), nil)
+	if err != nil {
+		t.Fatalf("Failed to parse imposter response: %v", err)
+	}
+	defer testResp.Body.Close()
+
+	if testResp.StatusCode != 200 {
+		t.Errorf("Expected status 200 when any repeated header matches, got %d", testResp.StatusCode)
+	}
+	if links := testResp.Header.Values("Link"); len(links) != 2 || links[1] != "</b>; rel=prev" {
+		t.Errorf("Expected two Link header lines in order, got %v", links)
+	}
+	if !strings.Contains(string(rawResp), "\r\nx-trace-ID: abc\r\n") {
+		t.Errorf("Expected response header name case to be preserved, got:\n%s", rawResp)
+	}
+
+	// Recorded request keeps header case, order and repeats
+	getResp, err := http.Get("http://localhost:2537/imposters/4558")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	defer getResp.Body.Close()
+
+	var imposter struct {
+		Requests []struct {
+			Headers    map[string]interface{} `json:"headers"`
+			RawHeaders []string               `json:"rawHeaders"`
+		} `json:"requests"`
+	}
+	if err := json.NewDecoder(getResp.Body).Decode(&imposter); err != nil {
+		t.Fatalf("Failed to decode imposter: %v", err)
+	}
+	if len(imposter.Requests) != 1 {
+		t.Fatalf("Expected 1 recorded request, got %d", len(imposter.Requests))
+	}
+
+	recorded := imposter.Requests[0]
+	expectedRaw := []string{
+		"host", "localhost:4558",
+		"X-API-Version", "v1",
+		"x-api-version", "v2",
+		"X-lower-UPPER", "Mixed",
+		"Connection", "close",
+	}
+	if fmt.Sprint(recorded.RawHeaders) != fmt.Sprint(expectedRaw) {
+		t.Errorf("Expected rawHeaders %v, got %v", expectedRaw, recorded.RawHeaders)
+	}
+	if _, ok := recorded.Headers["X-lower-UPPER"]; !ok {
+		t.Errorf("Expected header 'X-lower-UPPER' to keep its case, got %v", recorded.Headers)
+	}
+	if versions, ok := recorded.Headers["X-API-Version"].([]interface{}); !ok || len(versions) != 2 {
+		t.Errorf("Expected repeated X-API-Version header as array, got %v", recorded.Headers["X-API-Version"])
+	}
+
+	// A large upload doesn't disturb the next request on the connection
+	keepAlive, err := net.Dial("tcp", "localhost:4558")
+	if err != nil {
+		t.Fatalf("Failed to connect to imposter: %v", err)
+	}
+	defer keepAlive.Close()
+	reader := bufio.NewReader(keepAlive)
+
+	upload := strings.Repeat("x", 3<<20)
+	fmt.Fprintf(keepAlive, "POST /upload HTTP/1.1\r\nhost: localhost:4558\r\nContent-Length: %d\r\n\r\n%s", len(upload), upload)
+	for _, next := range []string{"GET /next HTTP/1.1\r\nhost: localhost:4558\r\nx-NEXT: 1\r\n\r\n", ""} {
+		keepAliveResp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("Failed to read imposter response: %v", err)
+		}
+		io.Copy(io.Discard, keepAliveResp.Body)
+		keepAliveResp.Body.Close()
+		fmt.Fprint(keepAlive, next)
+	}
+
+	getResp, err = http.Get("http://localhost:2537/imposters/4558")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	defer getResp.Body.Close()
+	if err := json.NewDecoder(getResp.Body).Decode(&imposter); err != nil {
+		t.Fatalf("Failed to decode imposter: %v", err)
+	}
+	if len(imposter.Requests) != 3 {
+		t.Fatalf("Expected 3 recorded requests, got %d", len(imposter.Requests))
+	}
+	expectedRaw = []string{"host", "localhost:4558", "x-NEXT", "1"}
+	if raw := imposter.Requests[2].RawHeaders; fmt.Sprint(raw) != fmt.Sprint(expectedRaw) {
+		t.Errorf("Expected rawHeaders %v after upload, got %v", expectedRaw, raw)
+	}
+}
@@ -0,0 +1,152 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+func TestLocalCA(t *testing.T) {
+	caDir := t.TempDir()
+
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2541,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+		CADir:       caDir,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Create imposter without a certificate
+	imposterConfig := map[string]interface{}{
+		"protocol": "https",
+		"port":     4562,
+		"stubs": []map[string]interface{}{
+			{
+				"responses": []map[string]interface{}{
+					{"is": map[string]interface{}{"body": "trusted"}},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2541/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Trust the CA published by the admin API
+	caResp, err := http.Get("http://localhost:2541/ca.pem")
+	if err != nil {
+		t.Fatalf("Failed to get CA: %v", err)
+	}
+	defer caResp.Body.Close()
+
+	caPEM, _ := io.ReadAll(caResp.Body)
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("Expected PEM CA certificate, got '%s'", string(caPEM))
+	}
+
+	// The CA is persisted for later runs
+	persisted, err := os.ReadFile(filepath.Join(caDir, "mb-ca-cert.pem"))
+	if err != nil || !bytes.Equal(persisted, caPEM) {
+		t.Errorf("Expected CA certificate to be persisted in %s", caDir)
+	}
+
+	dialTo := func(port string) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, "localhost:"+port)
+				},
+			},
+		}
+	}
+
+	// Certificates are minted for host names and IP addresses
+	for _, url := range []string{"https://secure.example.test/", "https://127.0.0.1:4562/"} {
+		testResp, err := dialTo("4562").Get(url)
+		if err != nil {
+			t.Fatalf("Failed to call %s with trusted CA: %v", url, err)
+		}
+		respBody, _ := io.ReadAll(testResp.Body)
+		testResp.Body.Close()
+		if string(respBody) != "trusted" {
+			t.Errorf("Expected body 'trusted', got '%s'", string(respBody))
+		}
+	}
+
+	// Key and certificate can be given as file paths
+	ca, err := util.LoadOrCreateCertificateAuthority(caDir)
+	if err != nil {
+		t.Fatalf("Failed to load CA: %v", err)
+	}
+	leaf, _ := ca.CertificateFor("files.example.test")
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(leaf.PrivateKey)
+	certPath := filepath.Join(t.TempDir(), "cert.pem")
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Certificate[0]}), 0644)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	fileConfig := map[string]interface{}{
+		"protocol": "https",
+		"port":     4563,
+		"cert":     certPath,
+		"key":      keyPath,
+	}
+	body, _ = json.Marshal(fileConfig)
+	resp2, err := http.Post("http://localhost:2541/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 for file paths, got %d", resp2.StatusCode)
+	}
+
+	testResp, err := dialTo("4563").Get("https://files.example.test/")
+	if err != nil {
+		t.Fatalf("Failed to call imposter with certificate from file: %v", err)
+	}
+	defer testResp.Body.Close()
+
+	if names := testResp.TLS.PeerCertificates[0].DNSNames; len(names) != 1 || names[0] != "files.example.test" {
+		t.Errorf("Expected certificate loaded from file, got %v", names)
+	}
+}
@@ -0,0 +1,131 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestPredicateValidation(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2553,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	post := func(url string, payload interface{}) (int, string) {
+		body, _ := json.Marshal(payload)
+		resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	stub := func(predicate map[string]interface{}, body string) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{predicate},
+			"responses": []map[string]interface{}{
+				{"is": map[string]interface{}{"body": body}},
+			},
+		}
+	}
+
+	// Invalid patterns and selectors are rejected when the imposter is created
+	invalid := map[string]map[string]interface{}{
+		"regular expression": {"matches": map[string]interface{}{"path": "/orders/(\\d+"}},
+		"xpath":              {"equals": "x", "xpath": map[string]interface{}{"selector": "//item[@"}},
+		"jsonpath":           {"equals": "x", "jsonpath": map[string]interface{}{"selector": "body.id"}},
+		"nested":             {"not": map[string]interface{}{"matches": map[string]interface{}{"path": "["}}},
+	}
+	for name, predicate := range invalid {
+		status, body := post("http://localhost:2553/imposters", map[string]interface{}{
+			"protocol": "http",
+			"port":     4576,
+			"stubs":    []map[string]interface{}{stub(predicate, name)},
+		})
+		if status != http.StatusBadRequest {
+			t.Errorf("Expected invalid %s to be rejected, got %d", name, status)
+		}
+		if !strings.Contains(body, "bad data") {
+			t.Errorf("Expected a validation error for invalid %s, got %s", name, body)
+		}
+	}
+
+	// Binary imposters reject matches, which cannot apply to base64 data
+	status, body := post("http://localhost:2553/imposters", map[string]interface{}{
+		"protocol": "http",
+		"port":     4576,
+		"mode":     "binary",
+		"stubs":    []map[string]interface{}{stub(map[string]interface{}{"matches": map[string]interface{}{"body": "^AA"}}, "binary")},
+	})
+	if status != http.StatusBadRequest || !strings.Contains(body, "binary mode") {
+		t.Errorf("Expected matches to be rejected in binary mode, got %d %s", status, body)
+	}
+
+	// Compiled predicates match as before
+	status, _ = post("http://localhost:2553/imposters", map[string]interface{}{
+		"protocol": "http",
+		"port":     4576,
+		"stubs": []map[string]interface{}{
+			stub(map[string]interface{}{"matches": map[string]interface{}{"path": "^/ORDERS/\\d+$"}}, "order"),
+			stub(map[string]interface{}{"equals": "widget", "xpath": map[string]interface{}{"selector": "//item/name"}}, "xml"),
+			stub(map[string]interface{}{"equals": map[string]interface{}{"body": map[string]interface{}{"Name": "GADGET"}}}, "json"),
+		},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	call := func(method, path, body string) string {
+		req, _ := http.NewRequest(method, "http://localhost:4576"+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to call imposter: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	if got := call("GET", "/orders/42", ""); got != "order" {
+		t.Errorf("Expected case-insensitive regex match, got '%s'", got)
+	}
+	if got := call("POST", "/items", "<item><name>Widget</name></item>"); got != "xml" {
+		t.Errorf("Expected xpath match, got '%s'", got)
+	}
+	if got := call("POST", "/items", `{"name": "gadget"}`); got != "json" {
+		t.Errorf("Expected case-insensitive body match, got '%s'", got)
+	}
+
+	// Stubs added later are validated too
+	status, _ = post("http://localhost:2553/imposters/4576/stubs", map[string]interface{}{
+		"stub": stub(map[string]interface{}{"matches": map[string]interface{}{"body": "*"}}, "bad"),
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected invalid stub to be rejected, got %d", status)
+	}
+}
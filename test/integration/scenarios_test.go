@@ -0,0 +1,252 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestScenarios(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2548,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	stub := func(method, state, newState, body string) map[string]interface{} {
+		return map[string]interface{}{
+			"scenario": "order",
+			"state":    state,
+			"newState": newState,
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"method": method, "path": "/orders/1"}},
+			},
+			"responses": []map[string]interface{}{
+				{"is": map[string]interface{}{"body": body}},
+			},
+		}
+	}
+
+	// Create imposter with a create -> pending -> approved flow
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4570,
+		"stubs": []map[string]interface{}{
+			stub("PUT", "Started", "pending", "created"),
+			stub("GET", "pending", "approved", "pending"),
+			stub("GET", "approved", "", "approved"),
+			stub("GET", "", "", "not found"),
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2548/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	call := func(method, url string) string {
+		req, _ := http.NewRequest(method, url, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to call %s %s: %v", method, url, err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return string(data)
+	}
+
+	scenario := func(method string) map[string]interface{} {
+		var result map[string]interface{}
+		json.Unmarshal([]byte(call(method, "http://localhost:2548/imposters/4570/scenarios/order")), &result)
+		return result
+	}
+
+	// Stubs requiring a later state do not match yet
+	if got := call("GET", "http://localhost:4570/orders/1"); got != "not found" {
+		t.Errorf("Expected 'not found' before the order exists, got '%s'", got)
+	}
+
+	for _, step := range []struct{ method, expected, state string }{
+		{"PUT", "created", "pending"},
+		{"GET", "pending", "approved"},
+		{"GET", "approved", "approved"},
+	} {
+		if got := call(step.method, "http://localhost:4570/orders/1"); got != step.expected {
+			t.Errorf("Expected '%s', got '%s'", step.expected, got)
+		}
+		if state := scenario("GET")["state"]; state != step.state {
+			t.Errorf("Expected scenario state '%s', got '%v'", step.state, state)
+		}
+	}
+
+	// Scenarios are listed with their possible states
+	var list struct {
+		Scenarios []struct {
+			Name           string   `json:"name"`
+			PossibleStates []string `json:"possibleStates"`
+		} `json:"scenarios"`
+	}
+	json.Unmarshal([]byte(call("GET", "http://localhost:2548/imposters/4570/scenarios")), &list)
+	if len(list.Scenarios) != 1 || list.Scenarios[0].Name != "order" || len(list.Scenarios[0].PossibleStates) != 3 {
+		t.Errorf("Unexpected scenario list: %+v", list)
+	}
+
+	// Resetting starts the flow again
+	if state := scenario("DELETE")["state"]; state != "Started" {
+		t.Errorf("Expected reset scenario to be Started, got '%v'", state)
+	}
+	if got := call("GET", "http://localhost:4570/orders/1"); got != "not found" {
+		t.Errorf("Expected 'not found' after reset, got '%s'", got)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:2548/imposters/4570/scenarios/missing", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get scenario: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown scenario, got %d", res.StatusCode)
+	}
+
+	// Only one of many concurrent requests wins a transition
+	scenario("DELETE")
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("PUT", "http://localhost:4570/orders/1", nil)
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+			data, _ := io.ReadAll(res.Body)
+			if string(data) == "created" {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("Expected exactly one concurrent request to create the order, got %d", created)
+	}
+}
+
+func TestScenarioKeptWhenStubRemoved(t *testing.T) {
+	config := &server.Config{
+		Port:           2562,
+		Host:           "localhost",
+		LogLevel:       "error",
+		IPWhitelist:    []string{"*"},
+		AllowInjection: true,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// A slow predicate gives time to delete its stub before the match is recorded
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4591,
+		"stubs": []map[string]interface{}{
+			{
+				"id":       "slow",
+				"scenario": "order",
+				"state":    "Started",
+				"newState": "done",
+				"predicates": []map[string]interface{}{
+					{"inject": "function (config) { var end = Date.now() + 500; while (Date.now() < end) {} return true; }"},
+				},
+				"responses": []map[string]interface{}{
+					{"is": map[string]interface{}{"body": "slow"}},
+				},
+			},
+			{
+				"scenario": "order",
+				"state":    "done",
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/done"}},
+				},
+				"responses": []map[string]interface{}{
+					{"is": map[string]interface{}{"body": "done"}},
+				},
+			},
+		},
+	}
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2562/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	resp.Body.Close()
+
+	call := func(method, url string) string {
+		req, _ := http.NewRequest(method, url, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to call %s %s: %v", method, url, err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return string(data)
+	}
+
+	done := make(chan string)
+	go func() {
+		done <- call("GET", "http://localhost:4591/")
+	}()
+	time.Sleep(100 * time.Millisecond)
+	call("DELETE", "http://localhost:2562/imposters/4591/stubs/slow")
+
+	if got := <-done; got == "slow" {
+		t.Errorf("Expected the deleted stub not to respond")
+	}
+	var scenario map[string]interface{}
+	json.Unmarshal([]byte(call("GET", "http://localhost:2562/imposters/4591/scenarios/order")), &scenario)
+	if scenario["state"] != "Started" {
+		t.Errorf("Expected the scenario to stay in Started, got %v", scenario)
+	}
+}
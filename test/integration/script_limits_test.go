@@ -0,0 +1,156 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestScriptLimits(t *testing.T) {
+	// Start mountebank server with a server-wide script timeout
+	config := &server.Config{
+		Port:             2554,
+		Host:             "localhost",
+		LogLevel:         "error",
+		IPWhitelist:      []string{"*"},
+		AllowInjection:   true,
+		InjectionTimeout: 2000,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	get := func(url string) (int, string) {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	stub := func(path string, response map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{response},
+		}
+	}
+
+	// The imposter overrides the server timeout with a shorter one
+	imposter := map[string]interface{}{
+		"protocol":         "http",
+		"port":             4578,
+		"injectionTimeout": 100,
+		"stubs": []map[string]interface{}{
+			stub("/loop", map[string]interface{}{
+				"inject": "function (config) { while (true) {} }",
+			}),
+			stub("/decorate", map[string]interface{}{
+				"is": map[string]interface{}{"body": "plain"},
+				"behaviors": []map[string]interface{}{
+					{"decorate": "function (config) { while (true) {} }"},
+				},
+			}),
+			stub("/recurse", map[string]interface{}{
+				"inject": "function (config) { var f = function (n) { return f(n + 1) + 1; }; return f(0); }",
+			}),
+			stub("/ok", map[string]interface{}{
+				"inject": "function (config) { return { body: 'fine' }; }",
+			}),
+			{
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/predicate"}},
+					{"inject": "function (config) { while (true) {} }"},
+				},
+				"responses": []map[string]interface{}{{"is": map[string]interface{}{"body": "matched"}}},
+			},
+		},
+	}
+	payload, _ := json.Marshal(imposter)
+	resp, err := http.Post("http://localhost:2554/imposters", "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+
+	// Runaway scripts are interrupted after the imposter's timeout
+	for _, path := range []string{"/loop", "/decorate", "/predicate"} {
+		start := time.Now()
+		status, body := get("http://localhost:4578" + path)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected %s to be interrupted after 100ms, took %v", path, elapsed)
+		}
+		if status != http.StatusInternalServerError {
+			t.Errorf("Expected 500 for %s, got %d", path, status)
+		}
+		if body != "injection execution failed: timeout" {
+			t.Errorf("Expected a timeout error for %s, got %q", path, body)
+		}
+	}
+
+	// Unbounded recursion fails on the call stack limit
+	status, body := get("http://localhost:4578/recurse")
+	if status != http.StatusInternalServerError || body != "injection execution failed: maximum call stack size exceeded" {
+		t.Errorf("Expected recursion to fail, got %d %q", status, body)
+	}
+
+	// Runtimes stay usable after being interrupted
+	status, body = get("http://localhost:4578/ok")
+	if status != http.StatusOK || body != "fine" {
+		t.Errorf("Expected 200 fine after interrupts, got %d %q", status, body)
+	}
+
+	// The override is part of the imposter definition
+	_, body = get("http://localhost:2554/imposters/4578")
+	if !strings.Contains(body, `"injectionTimeout":100`) {
+		t.Errorf("Expected injectionTimeout in imposter definition, got %s", body)
+	}
+
+	// Interrupted scripts are counted
+	_, body = get("http://localhost:2554/metrics")
+	for _, reason := range []string{"timeout", "stack"} {
+		if !strings.Contains(body, `mb_injection_interrupted_total{imposter="4578",reason="`+reason+`"}`) {
+			t.Errorf("Expected %s interrupts in metrics", reason)
+		}
+	}
+
+	// A negative timeout is rejected
+	payload, _ = json.Marshal(map[string]interface{}{"protocol": "http", "port": 4579, "injectionTimeout": -1})
+	resp, err = http.Post("http://localhost:2554/imposters", "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatalf("Failed to post imposter: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected negative injectionTimeout to be rejected, got %d", resp.StatusCode)
+	}
+
+	// Imposters created outside the API are checked the same way
+	negative := -1
+	if err := srv.CreateImposter(&models.ImposterConfig{Protocol: "http", Port: 4579, InjectionTimeout: &negative}); err == nil {
+		t.Errorf("Expected negative injectionTimeout to be rejected when creating an imposter")
+	}
+}
@@ -0,0 +1,220 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+func TestScriptModules(t *testing.T) {
+	// A modules directory with a helper depending on another module, and a
+	// secret kept outside it
+	root := t.TempDir()
+	modules := filepath.Join(root, "modules")
+	files := map[string]string{
+		"modules/helpers.js":     "var words = require('./lib/words');\nmodule.exports = { greet: function (name) { return words.hello + ' ' + name; } };",
+		"modules/lib/words.js":   "exports.hello = 'hello';",
+		"modules/data.json":      `{"greeting": "hi"}`,
+		"secret.js":              "module.exports = 'secret';",
+		"modules/lib/index.json": `{"index": true}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "secret.js"), filepath.Join(modules, "link.js")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	// Start mountebank server
+	config := &server.Config{
+		Port:           2557,
+		Host:           "localhost",
+		LogLevel:       "error",
+		IPWhitelist:    []string{"*"},
+		AllowInjection: true,
+		ModulesDir:     modules,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	inject := func(path, body string) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{
+				{"inject": "function (config) { return { body: " + body + " }; }"},
+			},
+		}
+	}
+
+	imposter := map[string]interface{}{
+		"protocol": "http",
+		"port":     4582,
+		"stubs": []map[string]interface{}{
+			inject("/greet", "require('helpers').greet('world')"),
+			inject("/cached", "String(require('helpers') === require('./helpers.js'))"),
+			inject("/json", "require('./data.json').greeting"),
+			inject("/hash", "require('crypto').createHash('sha256').update('abc').digest('hex')"),
+			inject("/hmac", "require('crypto').createHmac('sha1', 'key').update('abc').digest('base64')"),
+			inject("/buffer", "require('buffer').Buffer.from('hi').toString('base64')"),
+			inject("/missing", "require('nope')"),
+			inject("/escape", "require('../secret')"),
+			inject("/symlink", "require('./link')"),
+			{
+				"predicates": []map[string]interface{}{
+					{"inject": "function (config) { return config.request.path === '/' + require('lib/words').hello; }"},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{"body": "plain"},
+						"behaviors": []map[string]interface{}{
+							{"decorate": "function (config) { config.response.body = require('helpers').greet('decorated'); }"},
+						},
+					},
+				},
+			},
+		},
+	}
+	payload, _ := json.Marshal(imposter)
+	resp, err := http.Post("http://localhost:2557/imposters", "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/greet", http.StatusOK, "hello world"},
+		{"/cached", http.StatusOK, "true"},
+		{"/json", http.StatusOK, "hi"},
+		{"/hash", http.StatusOK, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"/hmac", http.StatusOK, "T9CyFSdu8S8rPkyOysKBFJi2Vvw="},
+		{"/buffer", http.StatusOK, "aGk="},
+		{"/hello", http.StatusOK, "hello decorated"},
+		{"/missing", http.StatusInternalServerError, "cannot find module 'nope'"},
+		{"/escape", http.StatusInternalServerError, "cannot require '../secret': outside the modules directory"},
+		{"/symlink", http.StatusInternalServerError, "outside the modules directory"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get("http://localhost:4582" + tt.path)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", tt.path, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status || !strings.Contains(string(data), tt.body) {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.path, tt.status, tt.body, resp.StatusCode, data)
+		}
+	}
+
+	// Middleware can require modules too
+	imposter = map[string]interface{}{
+		"protocol": "http",
+		"port":     4588,
+		"middleware": `function (config) {
+			if (config.request.path === '/blocked') {
+				return { statusCode: 403, body: require('helpers').greet('blocked') };
+			}
+			config.request.path = '/' + require('lib/words').hello;
+		}`,
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/hello"}},
+				},
+				"responses": []map[string]interface{}{
+					{"is": map[string]interface{}{"body": "rewritten"}},
+				},
+			},
+		},
+	}
+	payload, _ = json.Marshal(imposter)
+	resp, err = http.Post("http://localhost:2557/imposters", "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatalf("Failed to create middleware imposter: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/anything", http.StatusOK, "rewritten"},
+		{"/blocked", http.StatusForbidden, "hello blocked"},
+	} {
+		resp, err := http.Get("http://localhost:4588" + tt.path)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", tt.path, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status || string(data) != tt.body {
+			t.Errorf("middleware %s: expected %d %q, got %d %q", tt.path, tt.status, tt.body, resp.StatusCode, data)
+		}
+	}
+}
+
+func TestScriptModulesWithoutDirectory(t *testing.T) {
+	stub := func(body string) models.Stub {
+		return models.Stub{
+			Responses: []models.ResponseConfig{
+				{Inject: "function (config) { return { body: " + body + " }; }"},
+			},
+		}
+	}
+
+	// Built-in modules work without a modules directory, files do not
+	config := &models.ImposterConfig{Protocol: "http", Port: 4583, Stubs: []models.Stub{stub("require('crypto').createHash('md5').update('abc').digest('hex')")}}
+	imposter := models.NewImposter(config, util.NewLogger("error", "", true), true, nil, nil)
+	response, err := imposter.GetResponseFor(&models.Request{Method: "GET", Path: "/"}, nil)
+	if err != nil || response.Body != "900150983cd24fb0d6963f7d28e17f72" {
+		t.Errorf("Expected md5 digest, got %v, %v", response, err)
+	}
+
+	config = &models.ImposterConfig{Protocol: "http", Port: 4583, Stubs: []models.Stub{stub("require('helpers')")}}
+	imposter = models.NewImposter(config, util.NewLogger("error", "", true), true, nil, nil)
+	_, err = imposter.GetResponseFor(&models.Request{Method: "GET", Path: "/"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "only built-in modules can be required") {
+		t.Errorf("Expected require of a file to fail without a modules directory, got %v", err)
+	}
+}
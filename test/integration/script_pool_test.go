@@ -0,0 +1,182 @@
+package integration
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// Scripts taken from the injection and decoration integration tests
+const (
+	benchPredicateInject = "function(config) { return config.request.path === '/injected'; }"
+	benchDecorate        = `function(config) {
+		config.response.statusCode = 201;
+		config.response.body = "Decorated Body";
+		config.response.headers['X-Decorated'] = 'true';
+	}`
+	benchCounterInject = `function(config) {
+		config.state.count = (config.state.count || 0) + 1;
+		return { statusCode: 200, body: String(config.state.count) };
+	}`
+)
+
+func newScriptImposter() *models.Imposter {
+	config := &models.ImposterConfig{
+		Protocol: "http",
+		Port:     4577,
+		Stubs: []models.Stub{
+			{
+				Predicates: []models.Predicate{{Inject: benchPredicateInject}},
+				Responses:  []models.ResponseConfig{{Is: &models.Response{StatusCode: 200, Body: "Injected Match!"}}},
+			},
+			{
+				Predicates: []models.Predicate{{Equals: map[string]interface{}{"path": "/decorated"}}},
+				Responses: []models.ResponseConfig{{
+					Is: &models.Response{
+						StatusCode: 200,
+						Body:       "Original Body",
+						Headers:    map[string]interface{}{"X-Original": "true"},
+					},
+					Behaviors: []models.Behavior{{Decorate: benchDecorate}},
+				}},
+			},
+			{
+				Predicates: []models.Predicate{{Equals: map[string]interface{}{"path": "/counter"}}},
+				Responses:  []models.ResponseConfig{{Inject: benchCounterInject}},
+			},
+		},
+	}
+	if err := config.ValidateStubs(); err != nil {
+		panic(err)
+	}
+	return models.NewImposter(config, util.NewLogger("error", "", true), true, nil, nil)
+}
+
+func TestScriptStateIsShared(t *testing.T) {
+	imposter := newScriptImposter()
+
+	// Concurrent injections share, and serialize access to, the state
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := imposter.GetResponseFor(&models.Request{Method: "GET", Path: "/counter"}, nil); err != nil {
+				t.Errorf("Failed to inject response: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := respond(t, imposter, "GET", "/counter"); got != "51" {
+		t.Errorf("Expected state to count 51 requests, got %v", got)
+	}
+	if got := respond(t, imposter, "GET", "/injected"); got != "Injected Match!" {
+		t.Errorf("Expected predicate injection to match, got %v", got)
+	}
+	if got := respond(t, imposter, "GET", "/decorated"); got != "Decorated Body" {
+		t.Errorf("Expected decorated body, got %v", got)
+	}
+}
+
+func TestScriptGlobalsDoNotLeak(t *testing.T) {
+	config := &models.ImposterConfig{
+		Protocol: "http",
+		Port:     4577,
+		Stubs: []models.Stub{
+			{
+				Predicates: []models.Predicate{{Equals: map[string]interface{}{"path": "/leak"}}},
+				Responses:  []models.ResponseConfig{{Inject: "function(config) { leaked = 'yes'; JSON = null; return { body: 'leaked' }; }"}},
+			},
+			{
+				Responses: []models.ResponseConfig{{Inject: "function(config) { return { body: typeof leaked + ' ' + typeof JSON }; }"}},
+			},
+		},
+	}
+	if err := config.ValidateStubs(); err != nil {
+		t.Fatalf("Failed to validate stubs: %v", err)
+	}
+	imposter := models.NewImposter(config, util.NewLogger("error", "", true), true, nil, nil)
+
+	for i := 0; i < 5; i++ {
+		if got := respond(t, imposter, "GET", "/leak"); got != "leaked" {
+			t.Fatalf("Expected leaking script to run, got %v", got)
+		}
+		if got := respond(t, imposter, "GET", "/read"); got != "undefined object" {
+			t.Errorf("Expected a clean runtime, got %v", got)
+		}
+	}
+}
+
+func TestBusyScriptPoolDoesNotBlock(t *testing.T) {
+	config := &models.ImposterConfig{
+		Protocol: "http",
+		Port:     4577,
+		Stubs: []models.Stub{
+			{
+				Predicates: []models.Predicate{{Equals: map[string]interface{}{"path": "/slow"}}},
+				Responses:  []models.ResponseConfig{{Inject: "function(config) { setTimeout(function() { callback({ body: 'slow' }); }, 500); }"}},
+			},
+			{
+				Responses: []models.ResponseConfig{{Inject: "function(config) { return { body: 'fast' }; }"}},
+			},
+		},
+	}
+	if err := config.ValidateStubs(); err != nil {
+		t.Fatalf("Failed to validate stubs: %v", err)
+	}
+	imposter := models.NewImposter(config, util.NewLogger("error", "", true), true, nil, nil)
+
+	// Hold more runtimes than the pool keeps
+	var wg sync.WaitGroup
+	for i := 0; i <= 2*runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := imposter.GetResponseFor(&models.Request{Method: "GET", Path: "/slow"}, nil); err != nil {
+				t.Errorf("Failed to inject response: %v", err)
+			}
+		}()
+	}
+	defer wg.Wait()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if got := respond(t, imposter, "GET", "/fast"); got != "fast" {
+		t.Errorf("Expected fast response, got %v", got)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Expected a busy pool not to hold up scripts, took %v", elapsed)
+	}
+}
+
+func benchmarkScript(b *testing.B, path string) {
+	imposter := newScriptImposter()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := imposter.GetResponseFor(&models.Request{Method: "GET", Path: path}, nil); err != nil {
+				panic(fmt.Sprintf("Failed to respond to %s: %v", path, err))
+			}
+		}
+	})
+}
+
+func BenchmarkPredicateInjection(b *testing.B) {
+	benchmarkScript(b, "/injected")
+}
+
+func BenchmarkDecorateBehavior(b *testing.B) {
+	benchmarkScript(b, "/decorated")
+}
+
+func BenchmarkResponseInjection(b *testing.B) {
+	benchmarkScript(b, "/counter")
+}
@@ -0,0 +1,211 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestSharedState(t *testing.T) {
+	datadir := t.TempDir()
+
+	// Start mountebank server, saving state with the imposters
+	config := &server.Config{
+		Port:           2558,
+		Host:           "localhost",
+		LogLevel:       "error",
+		IPWhitelist:    []string{"*"},
+		AllowInjection: true,
+		Datadir:        datadir,
+		PersistState:   true,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+
+	call := func(method, url string, payload interface{}) (int, string) {
+		var body io.Reader
+		if payload != nil {
+			data, _ := json.Marshal(payload)
+			body = bytes.NewBuffer(data)
+		}
+		req, _ := http.NewRequest(method, url, body)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to call %s %s: %v", method, url, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(bytes.TrimSpace(data))
+	}
+	expect := func(method, url string, payload interface{}, status int, body string) {
+		t.Helper()
+		gotStatus, gotBody := call(method, url, payload)
+		if gotStatus != status || gotBody != body {
+			t.Errorf("%s %s: expected %d %s, got %d %s", method, url, status, body, gotStatus, gotBody)
+		}
+	}
+
+	// Each imposter counts its own requests and all requests together
+	counter := "function (config) { config.state.count = (config.state.count || 0) + 1; config.globalState.total = (config.globalState.total || 0) + 1; return { body: config.state.count + '/' + config.globalState.total }; }"
+	for _, port := range []int{4584, 4585} {
+		status, body := call("POST", "http://localhost:2558/imposters", map[string]interface{}{
+			"protocol": "http",
+			"port":     port,
+			"stubs": []map[string]interface{}{
+				{
+					"predicates": []map[string]interface{}{
+						{"inject": "function (config) { return config.globalState.closed === true; }"},
+					},
+					"responses": []map[string]interface{}{
+						{"is": map[string]interface{}{"statusCode": 503}},
+					},
+				},
+				{"responses": []map[string]interface{}{{"inject": counter}}},
+			},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("Failed to create imposter on %d: %d %s", port, status, body)
+		}
+	}
+
+	expect("GET", "http://localhost:4584/", nil, 200, "1/1")
+	expect("GET", "http://localhost:4584/", nil, 200, "2/2")
+	expect("GET", "http://localhost:4585/", nil, 200, "1/3")
+
+	// State can be inspected and seeded
+	expect("GET", "http://localhost:2558/imposters/4584/state", nil, 200, `{"count":2}`)
+	expect("GET", "http://localhost:2558/state", nil, 200, `{"total":3}`)
+	expect("PUT", "http://localhost:2558/imposters/4585/state", map[string]interface{}{"count": 10}, 200, `{"count":10}`)
+	expect("GET", "http://localhost:4585/", nil, 200, "11/4")
+
+	// Predicates see global state too
+	expect("PUT", "http://localhost:2558/state", map[string]interface{}{"closed": true}, 200, `{"closed":true}`)
+	expect("GET", "http://localhost:4584/", nil, 503, "")
+	expect("DELETE", "http://localhost:2558/state", nil, 200, `{}`)
+	expect("GET", "http://localhost:4584/", nil, 200, "3/1")
+
+	if status, _ := call("PUT", "http://localhost:2558/state", []int{1}); status != http.StatusBadRequest {
+		t.Errorf("Expected a non-object state to be rejected, got %d", status)
+	}
+	if status, _ := call("GET", "http://localhost:2558/imposters/4599/state", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for state of a missing imposter, got %d", status)
+	}
+
+	// State is saved alongside the imposters and deleted with them
+	if _, err := os.Stat(filepath.Join(datadir, "state", "4584.json")); err != nil {
+		t.Errorf("Expected imposter state to be saved: %v", err)
+	}
+	call("DELETE", "http://localhost:2558/imposters/4585", nil)
+	if _, err := os.Stat(filepath.Join(datadir, "state", "4585.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected state of a deleted imposter to be removed, got %v", err)
+	}
+	srv.Stop()
+
+	// A restarted server picks up where the first left off
+	config.Port = 2559
+	srv, err = server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	expect("GET", "http://localhost:4584/", nil, 200, "4/2")
+}
+
+func TestStateReleasedWhileWaiting(t *testing.T) {
+	config := &server.Config{
+		Port:           2561,
+		Host:           "localhost",
+		LogLevel:       "error",
+		IPWhitelist:    []string{"*"},
+		AllowInjection: true,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// A slow script touches state, then waits before touching it again
+	slow := "function (config) { config.state.waiting = true; return new Promise(function (resolve) { setTimeout(function () { config.state.count = (config.state.count || 0) + 1; resolve({ body: 'slow ' + config.state.count }); }, 500); }); }"
+	fast := "function (config) { config.state.count = (config.state.count || 0) + 1; return { body: 'fast ' + config.state.count }; }"
+	payload, _ := json.Marshal(map[string]interface{}{
+		"protocol": "http",
+		"port":     4589,
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{{"equals": map[string]interface{}{"path": "/slow"}}},
+				"responses":  []map[string]interface{}{{"inject": slow}},
+			},
+			{"responses": []map[string]interface{}{{"inject": fast}}},
+		},
+	})
+	resp, err := http.Post("http://localhost:2561/imposters", "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	resp.Body.Close()
+
+	get := func(url string) string {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(bytes.TrimSpace(data))
+	}
+
+	slowBody := make(chan string)
+	go func() {
+		slowBody <- get("http://localhost:4589/slow")
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Other scripts and the admin API are not held up by the waiting script
+	start := time.Now()
+	if body := get("http://localhost:4589/"); body != "fast 1" {
+		t.Errorf("Expected fast 1, got %s", body)
+	}
+	if body := get("http://localhost:2561/imposters/4589/state"); body != `{"count":1,"waiting":true}` {
+		t.Errorf("Expected state changed before the wait, got %s", body)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("Expected state to be free while a script waits, took %v", elapsed)
+	}
+
+	if body := <-slowBody; body != "slow 2" {
+		t.Errorf("Expected slow 2, got %s", body)
+	}
+}
@@ -0,0 +1,141 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestStubEnabled(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2552,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	stub := func(path string, statusCode int) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{
+				{"is": map[string]interface{}{"statusCode": statusCode}},
+			},
+		}
+	}
+
+	// Outage stubs start disabled ahead of the normal ones
+	ordersDown := stub("/orders", 503)
+	ordersDown["id"] = "orders-down"
+	ordersDown["enabled"] = false
+	ordersDown["tags"] = []string{"outage"}
+	usersDown := stub("/users", 503)
+	usersDown["enabled"] = false
+	usersDown["tags"] = []string{"outage"}
+
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4574,
+		"stubs":    []map[string]interface{}{ordersDown, usersDown, stub("/orders", 200), stub("/users", 200)},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2552/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	status := func(url string) int {
+		res, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", url, err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	post := func(url string) int {
+		res, err := http.Post(url, "application/json", nil)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", url, err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if got := status("http://localhost:4574/orders"); got != 200 {
+		t.Errorf("Expected disabled outage stub to be skipped, got %d", got)
+	}
+
+	// Enabling the tag turns on the whole outage
+	if got := post("http://localhost:2552/imposters/4574/stubs/enable?tag=outage"); got != 200 {
+		t.Fatalf("Expected enabling by tag to succeed, got %d", got)
+	}
+	if got := status("http://localhost:4574/orders"); got != 503 {
+		t.Errorf("Expected orders outage, got %d", got)
+	}
+	if got := status("http://localhost:4574/users"); got != 503 {
+		t.Errorf("Expected users outage, got %d", got)
+	}
+
+	// A single stub can be switched off again
+	if got := post("http://localhost:2552/imposters/4574/stubs/orders-down/disable"); got != 200 {
+		t.Fatalf("Expected disabling by id to succeed, got %d", got)
+	}
+	if got := status("http://localhost:4574/orders"); got != 200 {
+		t.Errorf("Expected orders to recover, got %d", got)
+	}
+	if got := status("http://localhost:4574/users"); got != 503 {
+		t.Errorf("Expected users outage to continue, got %d", got)
+	}
+
+	// Disabled stubs keep their place in the imposter
+	res, err := http.Get("http://localhost:2552/imposters/4574")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	var imposter struct {
+		Stubs []struct {
+			ID      string `json:"id"`
+			Enabled *bool  `json:"enabled"`
+		} `json:"stubs"`
+	}
+	json.Unmarshal(data, &imposter)
+	if len(imposter.Stubs) != 4 {
+		t.Fatalf("Expected 4 stubs, got %d", len(imposter.Stubs))
+	}
+	if first := imposter.Stubs[0]; first.ID != "orders-down" || first.Enabled == nil || *first.Enabled {
+		t.Errorf("Expected orders-down to stay first and disabled, got %+v", first)
+	}
+
+	if got := post("http://localhost:2552/imposters/4574/stubs/enable?tag=unknown"); got != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown tag, got %d", got)
+	}
+}
@@ -0,0 +1,208 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestStubExpiry(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:           2551,
+		Host:           "localhost",
+		LogLevel:       "error",
+		IPWhitelist:    []string{"*"},
+		AllowInjection: true,
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	stub := func(path string, statusCode int) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{
+				{"is": map[string]interface{}{"statusCode": statusCode}},
+			},
+		}
+	}
+
+	// A one-off failure, a stub living for a second, and the normal stubs
+	once := stub("/orders", 503)
+	once["expiresAfterMatches"] = 1
+	twice := stub("/retry", 500)
+	twice["expiresAfterMatches"] = 2
+	shortLived := stub("/flag", 418)
+	shortLived["ttlSeconds"] = 1
+
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4573,
+		"stubs": []map[string]interface{}{
+			once, twice, shortLived,
+			stub("/orders", 200), stub("/retry", 200), stub("/flag", 200),
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2551/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	status := func(url string) int {
+		res, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", url, err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	for i, expected := range []int{503, 200, 200} {
+		if got := status("http://localhost:4573/orders"); got != expected {
+			t.Errorf("Expected orders call %d to return %d, got %d", i+1, expected, got)
+		}
+	}
+	for i, expected := range []int{500, 500, 200} {
+		if got := status("http://localhost:4573/retry"); got != expected {
+			t.Errorf("Expected retry call %d to return %d, got %d", i+1, expected, got)
+		}
+	}
+
+	if got := status("http://localhost:4573/flag"); got != 418 {
+		t.Errorf("Expected short-lived stub to match, got %d", got)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if got := status("http://localhost:4573/flag"); got != 200 {
+		t.Errorf("Expected short-lived stub to have expired, got %d", got)
+	}
+
+	// Expired stubs are removed from the imposter
+	res, err := http.Get("http://localhost:2551/imposters/4573")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	var imposter struct {
+		Stubs []map[string]interface{} `json:"stubs"`
+	}
+	json.Unmarshal(data, &imposter)
+	if len(imposter.Stubs) != 3 {
+		t.Errorf("Expected 3 remaining stubs, got %d", len(imposter.Stubs))
+	}
+
+	// Expiry counts must be positive
+	invalid := stub("/invalid", 200)
+	invalid["expiresAfterMatches"] = 0
+	body, _ = json.Marshal(map[string]interface{}{"stub": invalid})
+	addResp, err := http.Post("http://localhost:2551/imposters/4573/stubs", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to add stub: %v", err)
+	}
+	addResp.Body.Close()
+	if addResp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for expiresAfterMatches 0, got %d", addResp.StatusCode)
+	}
+
+	// Patching other fields keeps the match count
+	patched := stub("/patched", 409)
+	patched["id"] = "patched"
+	patched["expiresAfterMatches"] = 2
+	body, _ = json.Marshal(map[string]interface{}{"stub": patched})
+	addResp, err = http.Post("http://localhost:2551/imposters/4573/stubs", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to add stub: %v", err)
+	}
+	addResp.Body.Close()
+
+	if got := status("http://localhost:4573/patched"); got != 409 {
+		t.Errorf("Expected patched stub to match, got %d", got)
+	}
+	req, _ := http.NewRequest("PATCH", "http://localhost:2551/imposters/4573/stubs/patched", bytes.NewBufferString(`{"tags": ["flaky"]}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	patchResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to patch stub: %v", err)
+	}
+	patchResp.Body.Close()
+	if patchResp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 for patch, got %d", patchResp.StatusCode)
+	}
+	for i, expected := range []int{409, 200} {
+		if got := status("http://localhost:4573/patched"); got != expected {
+			t.Errorf("Expected patched call %d to return %d, got %d", i+2, expected, got)
+		}
+	}
+
+	// A slow predicate doesn't hold up other requests or the admin API
+	slow := map[string]interface{}{
+		"predicates": []map[string]interface{}{
+			{"inject": "function (config) { var end = Date.now() + 500; while (Date.now() < end) {} return config.request.path === '/slow'; }"},
+		},
+		"responses": []map[string]interface{}{
+			{"is": map[string]interface{}{"statusCode": 202}},
+		},
+	}
+	body, _ = json.Marshal(map[string]interface{}{
+		"protocol": "http",
+		"port":     4587,
+		"stubs":    []map[string]interface{}{stub("/fast", 200), slow},
+	})
+	resp, err = http.Post("http://localhost:2551/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	resp.Body.Close()
+
+	slowDone := make(chan int, 1)
+	go func() {
+		res, err := http.Get("http://localhost:4587/slow")
+		if err != nil {
+			slowDone <- 0
+			return
+		}
+		res.Body.Close()
+		slowDone <- res.StatusCode
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if got := status("http://localhost:4587/fast"); got != 200 {
+		t.Errorf("Expected fast stub to match, got %d", got)
+	}
+	if got := status("http://localhost:2551/imposters/4587"); got != 200 {
+		t.Errorf("Expected to read the imposter, got %d", got)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("Expected requests not to wait for the slow predicate, took %v", elapsed)
+	}
+	if got := <-slowDone; got != 202 {
+		t.Errorf("Expected slow stub to match, got %d", got)
+	}
+}
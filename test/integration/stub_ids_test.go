@@ -0,0 +1,165 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestStubIDs(t *testing.T) {
+	// Start mountebank server, saving imposters as their stubs change
+	config := &server.Config{
+		Port:        2550,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+		Datadir:     t.TempDir(),
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	stub := func(path, body string) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"startsWith": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{
+				{"is": map[string]interface{}{"body": body}},
+			},
+		}
+	}
+
+	named := stub("/", "catch-all")
+	named["id"] = "catch-all"
+
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4572,
+		"stubs":    []map[string]interface{}{named, stub("/orders", "orders")},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2550/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	call := func(method, url string, payload interface{}) (int, string) {
+		var reader io.Reader
+		if payload != nil {
+			data, _ := json.Marshal(payload)
+			reader = bytes.NewBuffer(data)
+		}
+		req, _ := http.NewRequest(method, url, reader)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to call %s %s: %v", method, url, err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(data)
+	}
+
+	type stubInfo struct {
+		ID    string `json:"id"`
+		Links struct {
+			Self struct {
+				Href string `json:"href"`
+			} `json:"self"`
+		} `json:"_links"`
+	}
+	stubs := func() []stubInfo {
+		var imposter struct {
+			Stubs []stubInfo `json:"stubs"`
+		}
+		_, data := call("GET", "http://localhost:2550/imposters/4572", nil)
+		json.Unmarshal([]byte(data), &imposter)
+		return imposter.Stubs
+	}
+
+	// Generated ids are exposed in links
+	current := stubs()
+	if len(current) != 2 || current[0].ID != "catch-all" || current[1].ID == "" {
+		t.Fatalf("Expected supplied and generated ids, got %+v", current)
+	}
+	ordersID := current[1].ID
+	if current[1].Links.Self.Href != "/imposters/4572/stubs/"+ordersID {
+		t.Errorf("Expected id-based link, got '%s'", current[1].Links.Self.Href)
+	}
+
+	// The catch-all shadows the orders stub until it is moved after it
+	if _, got := call("GET", "http://localhost:4572/orders", nil); got != "catch-all" {
+		t.Errorf("Expected catch-all first, got '%s'", got)
+	}
+	if status, _ := call("POST", "http://localhost:2550/imposters/4572/stubs/catch-all/move", map[string]interface{}{"after": ordersID}); status != 200 {
+		t.Errorf("Expected move to succeed, got %d", status)
+	}
+	if _, got := call("GET", "http://localhost:4572/orders", nil); got != "orders" {
+		t.Errorf("Expected orders stub after move, got '%s'", got)
+	}
+	for _, move := range []map[string]interface{}{
+		{"before": ordersID, "after": ordersID},
+		{"before": "missing"},
+	} {
+		if status, _ := call("POST", "http://localhost:2550/imposters/4572/stubs/catch-all/move", move); status != http.StatusBadRequest {
+			t.Errorf("Expected move %v to be rejected, got %d", move, status)
+		}
+	}
+
+	// Patch changes only the given fields
+	status, _ := call("PATCH", "http://localhost:2550/imposters/4572/stubs/"+ordersID, map[string]interface{}{
+		"responses": []map[string]interface{}{{"is": map[string]interface{}{"body": "patched"}}},
+	})
+	if status != 200 {
+		t.Errorf("Expected patch to succeed, got %d", status)
+	}
+	if _, got := call("GET", "http://localhost:4572/orders", nil); got != "patched" {
+		t.Errorf("Expected patched response, got '%s'", got)
+	}
+
+	// Get by id returns the stub with its predicates intact
+	_, data := call("GET", "http://localhost:2550/imposters/4572/stubs/"+ordersID, nil)
+	if !strings.Contains(data, `"/orders"`) || !strings.Contains(data, `"patched"`) {
+		t.Errorf("Unexpected stub: %s", data)
+	}
+
+	// Duplicate ids are rejected
+	duplicate := stub("/other", "other")
+	duplicate["id"] = "catch-all"
+	if status, _ := call("POST", "http://localhost:2550/imposters/4572/stubs", map[string]interface{}{"stub": duplicate}); status != http.StatusBadRequest {
+		t.Errorf("Expected duplicate id to be rejected, got %d", status)
+	}
+
+	// Delete by id leaves the other stub alone
+	if status, _ := call("DELETE", "http://localhost:2550/imposters/4572/stubs/"+ordersID, nil); status != 200 {
+		t.Errorf("Expected delete to succeed, got %d", status)
+	}
+	if current = stubs(); len(current) != 1 || current[0].ID != "catch-all" {
+		t.Errorf("Expected only the catch-all stub to remain, got %+v", current)
+	}
+	if status, _ := call("GET", "http://localhost:2550/imposters/4572/stubs/"+ordersID, nil); status != http.StatusNotFound {
+		t.Errorf("Expected deleted stub to be gone, got %d", status)
+	}
+}
@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mountebank-testing/mountebank-go/internal/models"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+// indexedStub returns a stub answering with body when the predicate matches
+func indexedStub(predicate models.Predicate, body string) models.Stub {
+	return models.Stub{
+		Predicates: []models.Predicate{predicate},
+		Responses:  []models.ResponseConfig{{Is: &models.Response{StatusCode: 200, Body: body}}},
+	}
+}
+
+func newIndexedImposter(stubs []models.Stub) *models.Imposter {
+	config := &models.ImposterConfig{Protocol: "http", Port: 4575, Stubs: stubs}
+	if err := config.ValidateStubs(); err != nil {
+		panic(err)
+	}
+	return models.NewImposter(config, util.NewLogger("error", "", true), false, nil, nil)
+}
+
+func respond(t testing.TB, imposter *models.Imposter, method, path string) interface{} {
+	response, err := imposter.GetResponseFor(&models.Request{Method: method, Path: path}, nil)
+	if err != nil {
+		t.Fatalf("Failed to respond to %s %s: %v", method, path, err)
+	}
+	return response.Body
+}
+
+func TestStubIndexKeepsFirstMatch(t *testing.T) {
+	caseSensitive := true
+	imposter := newIndexedImposter([]models.Stub{
+		indexedStub(models.Predicate{Equals: map[string]interface{}{"method": "DELETE"}}, "delete"),
+		indexedStub(models.Predicate{StartsWith: map[string]interface{}{"path": "/API"}}, "prefix"),
+		indexedStub(models.Predicate{Equals: map[string]interface{}{"path": "/api/orders"}}, "exact"),
+		indexedStub(models.Predicate{Equals: map[string]interface{}{"path": "/Users"}, CaseSensitive: &caseSensitive}, "sensitive"),
+		indexedStub(models.Predicate{Contains: map[string]interface{}{"path": "users"}}, "contains"),
+	})
+
+	tests := []struct {
+		method, path string
+		expected     interface{}
+	}{
+		{"GET", "/api/orders", "prefix"},
+		{"DELETE", "/api/orders", "delete"},
+		{"GET", "/Users", "sensitive"},
+		{"GET", "/users", "contains"},
+		{"GET", "/other", nil},
+	}
+	for _, tt := range tests {
+		if got := respond(t, imposter, tt.method, tt.path); got != tt.expected {
+			t.Errorf("Expected %s %s to return %v, got %v", tt.method, tt.path, tt.expected, got)
+		}
+	}
+
+	// The index follows changes to the stubs
+	if err := imposter.Stubs().InsertAtIndex(indexedStub(models.Predicate{Equals: map[string]interface{}{"path": "/API/ORDERS"}}, "inserted"), 0); err != nil {
+		t.Fatalf("Failed to insert stub: %v", err)
+	}
+	if got := respond(t, imposter, "GET", "/api/orders"); got != "inserted" {
+		t.Errorf("Expected inserted stub to match first, got %v", got)
+	}
+	if err := imposter.Stubs().DeleteAtIndex(0); err != nil {
+		t.Fatalf("Failed to delete stub: %v", err)
+	}
+	if got := respond(t, imposter, "GET", "/api/orders"); got != "prefix" {
+		t.Errorf("Expected prefix stub after delete, got %v", got)
+	}
+}
+
+// benchmarkStubs returns count stubs matching /resource/<n>/ with the given
+// operator, as recorded by a proxy
+func benchmarkStubs(count int, operator string) []models.Stub {
+	stubs := make([]models.Stub, count)
+	for i := range stubs {
+		fields := map[string]interface{}{"method": "GET", "path": fmt.Sprintf("/resource/%d/", i)}
+		var predicate models.Predicate
+		switch operator {
+		case "equals":
+			predicate.Equals = fields
+		case "startsWith":
+			predicate.StartsWith = fields
+		case "contains":
+			predicate.Contains = fields
+		}
+		stubs[i] = indexedStub(predicate, fmt.Sprint(i))
+	}
+	return stubs
+}
+
+func benchmarkLastStub(b *testing.B, operator string) {
+	const count = 10000
+	imposter := newIndexedImposter(benchmarkStubs(count, operator))
+	path := fmt.Sprintf("/resource/%d/", count-1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if got := respond(b, imposter, "GET", path); got != fmt.Sprint(count-1) {
+			b.Fatalf("Expected last stub to match, got %v", got)
+		}
+	}
+}
+
+func BenchmarkFirstMatch10kEquals(b *testing.B) {
+	benchmarkLastStub(b, "equals")
+}
+
+func BenchmarkFirstMatch10kStartsWith(b *testing.B) {
+	benchmarkLastStub(b, "startsWith")
+}
+
+// BenchmarkFirstMatch10kUnindexed is the baseline of evaluating every stub
+func BenchmarkFirstMatch10kUnindexed(b *testing.B) {
+	benchmarkLastStub(b, "contains")
+}
@@ -0,0 +1,201 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestTemplateBehavior(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2545,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Create imposter rendering templates without injection
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4567,
+		"stubs": []map[string]interface{}{
+			{
+				"predicates": []map[string]interface{}{
+					{"startsWith": map[string]interface{}{"path": "/users/"}},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"statusCode": 200,
+							"headers": map[string]interface{}{
+								"X-Request-Id": "{{uuid}}",
+								"X-Name":       "{{upper .request.query.name}}",
+							},
+							"body": "path={{.request.path}} " +
+								"ids={{range $i, $item := .request.json.items}}{{if $i}},{{end}}{{$item.id}}{{end}} " +
+								"{{if .request.json.vip}}vip{{else}}regular{{end}} " +
+								"encoded={{base64 .request.query.name}} " +
+								"missing=[{{.request.query.missing}}] " +
+								"raw=[{{.request.query.raw}}] " +
+								"year={{date \"2006\"}}",
+						},
+						"behaviors": []map[string]interface{}{{"template": true}},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/json"}},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is": map[string]interface{}{
+							"body": map[string]interface{}{
+								"echo":  "<%json .request.json%>",
+								"plain": "{{not a template}}",
+							},
+						},
+						"behaviors": []map[string]interface{}{
+							{"template": map[string]interface{}{"leftDelim": "<%", "rightDelim": "%>"}},
+						},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/disabled"}},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is":        map[string]interface{}{"body": "{{.request.path}}"},
+						"behaviors": []map[string]interface{}{{"template": false}},
+					},
+				},
+			},
+			{
+				"predicates": []map[string]interface{}{
+					{"equals": map[string]interface{}{"path": "/seq"}},
+				},
+				"responses": []map[string]interface{}{
+					{
+						"is":        map[string]interface{}{"body": "{{range seq .request.query.n}}x{{end}}{{randomString .request.query.n | len}}"},
+						"behaviors": []map[string]interface{}{{"template": true}},
+					},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2545/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Render against path, query, headers and JSON body
+	res, err := http.Post("http://localhost:4567/users/42?name=bob&raw=%3Cno+value%3E", "application/json",
+		bytes.NewBufferString(`{"items": [{"id": 1}, {"id": 2}], "vip": true}`))
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	expected := "path=/users/42 ids=1,2 vip encoded=" + base64.StdEncoding.EncodeToString([]byte("bob")) +
+		" missing=[] raw=[<no value>] year=" + time.Now().UTC().Format("2006")
+	if string(data) != expected {
+		t.Errorf("Expected body '%s', got '%s'", expected, data)
+	}
+	if name := res.Header.Get("X-Name"); name != "BOB" {
+		t.Errorf("Expected X-Name header BOB, got '%s'", name)
+	}
+	if id := res.Header.Get("X-Request-Id"); !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("Expected UUID request id, got '%s'", id)
+	}
+
+	// Custom delimiters leave other braces alone inside JSON bodies
+	res, err = http.Post("http://localhost:4567/json", "application/json", bytes.NewBufferString(`{"a":1}`))
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	var result map[string]string
+	json.NewDecoder(res.Body).Decode(&result)
+	res.Body.Close()
+
+	if result["echo"] != `{"a":1}` || result["plain"] != "{{not a template}}" {
+		t.Errorf("Unexpected templated JSON body: %v", result)
+	}
+
+	// Disabled templates stay disabled when the stub is read back
+	getResp, err := http.Get("http://localhost:2545/imposters/4567")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	var imposter struct {
+		Stubs []struct {
+			Responses []struct {
+				Behaviors []map[string]interface{} `json:"behaviors"`
+			} `json:"responses"`
+		} `json:"stubs"`
+	}
+	json.NewDecoder(getResp.Body).Decode(&imposter)
+	getResp.Body.Close()
+
+	if len(imposter.Stubs) != 4 {
+		t.Fatalf("Expected 4 stubs, got %d", len(imposter.Stubs))
+	}
+	behaviors := imposter.Stubs[2].Responses[0].Behaviors
+	if len(behaviors) != 1 || behaviors[0]["template"] != false {
+		t.Errorf("Expected disabled template behavior, got %v", behaviors)
+	}
+	if enabled := imposter.Stubs[0].Responses[0].Behaviors; len(enabled) != 1 || enabled[0]["template"] != true {
+		t.Errorf("Expected enabled template behavior, got %v", enabled)
+	}
+
+	// Lengths taken from the request are capped
+	for _, tt := range []struct {
+		n      string
+		status int
+		body   string
+	}{
+		{"3", http.StatusOK, "xxx3"},
+		{"100000000", http.StatusInternalServerError, ""},
+	} {
+		res, err := http.Get("http://localhost:4567/seq?n=" + tt.n)
+		if err != nil {
+			t.Fatalf("Failed to call imposter: %v", err)
+		}
+		data, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.status || !strings.Contains(string(data), tt.body) {
+			t.Errorf("seq %s: expected %d %q, got %d %q", tt.n, tt.status, tt.body, res.StatusCode, data)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestThrottleBehavior(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2544,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	stub := func(path string, throttle map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{
+				{
+					"is":        map[string]interface{}{"statusCode": 200, "body": "0123456789"},
+					"behaviors": []map[string]interface{}{{"throttle": throttle}},
+				},
+			},
+		}
+	}
+
+	// Throttles that could never write the body are rejected up front
+	for _, throttle := range []map[string]interface{}{
+		{"bytesPerSecond": 0},
+		{"chunkSize": -5},
+		{"stallAfter": -1},
+	} {
+		invalid := map[string]interface{}{
+			"protocol": "http",
+			"port":     4566,
+			"stubs":    []map[string]interface{}{stub("/invalid", throttle)},
+		}
+		body, _ := json.Marshal(invalid)
+		resp, err := http.Post("http://localhost:2544/imposters", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Failed to post imposter: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for throttle %v, got %d", throttle, resp.StatusCode)
+		}
+	}
+
+	// Create imposter with chunked, rate limited and stalling bodies
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4566,
+		"stubs": []map[string]interface{}{
+			stub("/chunks", map[string]interface{}{"chunkSize": 5, "chunkDelay": 200, "firstByteDelay": 100}),
+			stub("/rate", map[string]interface{}{"bytesPerSecond": 40}),
+			stub("/stall", map[string]interface{}{"stallAfter": 4}),
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2544/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Headers arrive quickly while the body trickles in
+	for _, test := range []struct {
+		path    string
+		minBody time.Duration
+	}{
+		{"/chunks", 300 * time.Millisecond},
+		{"/rate", 200 * time.Millisecond},
+	} {
+		start := time.Now()
+		res, err := http.Get("http://localhost:4566" + test.path)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", test.path, err)
+		}
+		headersAt := time.Since(start)
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		elapsed := time.Since(start)
+
+		if err != nil || string(data) != "0123456789" {
+			t.Errorf("Expected full body from %s, got '%s' (%v)", test.path, data, err)
+		}
+		if headersAt > 100*time.Millisecond {
+			t.Errorf("Expected headers from %s immediately, took %v", test.path, headersAt)
+		}
+		if elapsed < test.minBody || elapsed > 5*time.Second {
+			t.Errorf("Expected body from %s to take at least %v, took %v", test.path, test.minBody, elapsed)
+		}
+	}
+
+	// A stalled body times out the client's read after the first bytes
+	conn, err := net.Dial("tcp", "localhost:4566")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /stall HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read stalled response headers: %v", err)
+	}
+	if res.ContentLength != 10 {
+		t.Errorf("Expected Content-Length 10, got %d", res.ContentLength)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if string(data) != "0123" {
+		t.Errorf("Expected body to stall after '0123', got '%s'", data)
+	}
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Expected read timeout, got %v", err)
+	}
+}
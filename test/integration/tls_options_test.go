@@ -0,0 +1,184 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestTLSOptions(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2542,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+		CADir:       t.TempDir(),
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Invalid options are rejected
+	invalidConfig := map[string]interface{}{
+		"protocol": "https",
+		"port":     4564,
+		"tls": map[string]interface{}{
+			"cipherSuites": []string{"TLS_NOT_A_SUITE"},
+		},
+	}
+	body, _ := json.Marshal(invalidConfig)
+	resp, err := http.Post("http://localhost:2542/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to post imposter: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown cipher suite, got %d", resp.StatusCode)
+	}
+
+	// Create imposter pinned to TLS 1.2 with a single cipher suite
+	imposterConfig := map[string]interface{}{
+		"protocol": "https",
+		"port":     4564,
+		"tls": map[string]interface{}{
+			"minVersion":     "1.2",
+			"maxVersion":     "TLSv1.2",
+			"cipherSuites":   []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+			"curves":         []string{"P384"},
+			"alpn":           []string{"http/1.1"},
+			"sessionTickets": false,
+		},
+	}
+	body, _ = json.Marshal(imposterConfig)
+	resp, err = http.Post("http://localhost:2542/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Clients limited to other versions fail the handshake
+	for _, clientConfig := range []*tls.Config{
+		{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11},
+		{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13},
+	} {
+		if conn, err := tls.Dial("tcp", "localhost:4564", clientConfig); err == nil {
+			conn.Close()
+			t.Errorf("Expected handshake to fail for client versions %x-%x", clientConfig.MinVersion, clientConfig.MaxVersion)
+		}
+	}
+
+	// Modern clients negotiate the configured parameters
+	conn, err := tls.Dial("tcp", "localhost:4564", &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed handshake: %v", err)
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if state.Version != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2, got %x", state.Version)
+	}
+	if state.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("Expected configured cipher suite, got %s", tls.CipherSuiteName(state.CipherSuite))
+	}
+	if state.NegotiatedProtocol != "http/1.1" {
+		t.Errorf("Expected ALPN http/1.1, got '%s'", state.NegotiatedProtocol)
+	}
+
+	// Options are returned with the imposter
+	getResp, err := http.Get("http://localhost:2542/imposters/4564")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	defer getResp.Body.Close()
+
+	var imposter struct {
+		TLS struct {
+			MaxVersion string `json:"maxVersion"`
+		} `json:"tls"`
+	}
+	json.NewDecoder(getResp.Body).Decode(&imposter)
+	if imposter.TLS.MaxVersion != "TLSv1.2" {
+		t.Errorf("Expected tls options to be saved, got %+v", imposter.TLS)
+	}
+
+	// Imposters offering h2 serve HTTP/2 and still see the TLS state
+	h2Config := map[string]interface{}{
+		"protocol": "https",
+		"port":     4586,
+		"tls": map[string]interface{}{
+			"alpn": []string{"h2", "http/1.1"},
+		},
+		"stubs": []map[string]interface{}{
+			{
+				"responses": []map[string]interface{}{
+					{"is": map[string]interface{}{"body": "over h2"}},
+				},
+			},
+		},
+	}
+	body, _ = json.Marshal(h2Config)
+	resp, err = http.Post("http://localhost:2542/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 for ALPN h2, got %d", resp.StatusCode)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	h2Resp, err := client.Get("https://localhost:4586/")
+	if err != nil {
+		t.Fatalf("Failed to call imposter: %v", err)
+	}
+	h2Body, _ := io.ReadAll(h2Resp.Body)
+	h2Resp.Body.Close()
+	if h2Resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", h2Resp.Proto)
+	}
+	if string(h2Body) != "over h2" {
+		t.Errorf("Expected body 'over h2', got '%s'", string(h2Body))
+	}
+
+	requestsResp, err := http.Get("http://localhost:2542/imposters/4586")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	defer requestsResp.Body.Close()
+	var h2Imposter struct {
+		NumberOfRequests int `json:"numberOfRequests"`
+	}
+	json.NewDecoder(requestsResp.Body).Decode(&h2Imposter)
+	if h2Imposter.NumberOfRequests != 1 {
+		t.Errorf("Expected 1 request over h2, got %d", h2Imposter.NumberOfRequests)
+	}
+}
@@ -0,0 +1,165 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+	"github.com/mountebank-testing/mountebank-go/internal/util"
+)
+
+func TestVirtualHosts(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:        2540,
+		Host:        "localhost",
+		LogLevel:    "error",
+		IPWhitelist: []string{"*"},
+		CADir:       t.TempDir(),
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	// Mint a certificate for one of the virtual hosts
+	ca, err := util.NewCertificateAuthority("test CA")
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	apiCert, err := ca.CertificateFor("api.example.test")
+	if err != nil {
+		t.Fatalf("Failed to mint certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(apiCert.PrivateKey)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: apiCert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	// Create imposter pretending to be several domains on one port
+	imposterConfig := map[string]interface{}{
+		"protocol": "https",
+		"port":     4561,
+		"stubs": []map[string]interface{}{
+			{
+				"responses": []map[string]interface{}{
+					{"is": map[string]interface{}{"body": "fallback"}},
+				},
+			},
+		},
+		"virtualHosts": []map[string]interface{}{
+			{
+				"host": "api.example.test",
+				"cert": string(certPEM),
+				"key":  string(keyPEM),
+				"stubs": []map[string]interface{}{
+					{
+						"predicates": []map[string]interface{}{
+							{"equals": map[string]interface{}{"path": "/users"}},
+						},
+						"responses": []map[string]interface{}{
+							{"is": map[string]interface{}{"body": "api users"}},
+						},
+					},
+				},
+			},
+			{
+				"host": "*.shop.test",
+				"defaultResponse": map[string]interface{}{
+					"statusCode": 404,
+					"body":       "no such product",
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2540/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Route every host name to the imposter port
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, "localhost:4561")
+			},
+		},
+	}
+
+	get := func(url string) (*http.Response, string) {
+		res, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", url, err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return res, string(data)
+	}
+
+	// Exact host uses its own stubs and certificate
+	res, data := get("https://api.example.test/users")
+	if data != "api users" {
+		t.Errorf("Expected body 'api users', got '%s'", data)
+	}
+	if names := res.TLS.PeerCertificates[0].DNSNames; len(names) != 1 || names[0] != "api.example.test" {
+		t.Errorf("Expected virtual host certificate, got %v", names)
+	}
+
+	// Wildcard host uses its own default response and the imposter certificate
+	res, data = get("https://www.shop.test/items/1")
+	if res.StatusCode != 404 || data != "no such product" {
+		t.Errorf("Expected 404 'no such product', got %d '%s'", res.StatusCode, data)
+	}
+	if names := res.TLS.PeerCertificates[0].DNSNames; len(names) == 1 && names[0] == "api.example.test" {
+		t.Errorf("Expected default certificate for wildcard host")
+	}
+
+	// Unknown hosts fall back to the imposter's own stubs
+	_, data = get("https://other.test/")
+	if data != "fallback" {
+		t.Errorf("Expected body 'fallback', got '%s'", data)
+	}
+
+	// Virtual hosts are returned with the imposter
+	getResp, err := http.Get("http://localhost:2540/imposters/4561")
+	if err != nil {
+		t.Fatalf("Failed to get imposter: %v", err)
+	}
+	defer getResp.Body.Close()
+
+	var imposter struct {
+		VirtualHosts []struct {
+			Host  string        `json:"host"`
+			Stubs []interface{} `json:"stubs"`
+		} `json:"virtualHosts"`
+	}
+	json.NewDecoder(getResp.Body).Decode(&imposter)
+	if len(imposter.VirtualHosts) != 2 || imposter.VirtualHosts[0].Host != "api.example.test" || len(imposter.VirtualHosts[0].Stubs) != 1 {
+		t.Errorf("Unexpected virtual hosts: %+v", imposter.VirtualHosts)
+	}
+}
@@ -0,0 +1,150 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mountebank-testing/mountebank-go/internal/server"
+)
+
+func TestWaitBehavior(t *testing.T) {
+	// Start mountebank server
+	config := &server.Config{
+		Port:           2543,
+		Host:           "localhost",
+		LogLevel:       "error",
+		AllowInjection: true,
+		IPWhitelist:    []string{"*"},
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	go func() {
+		srv.Start()
+	}()
+
+	// Wait for server to start
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	stub := func(path string, wait interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"predicates": []map[string]interface{}{
+				{"equals": map[string]interface{}{"path": path}},
+			},
+			"responses": []map[string]interface{}{
+				{
+					"is":        map[string]interface{}{"statusCode": 200},
+					"behaviors": []map[string]interface{}{{"wait": wait}},
+				},
+			},
+		}
+	}
+
+	// Invalid distributions are rejected when the imposter is created
+	for _, wait := range []map[string]interface{}{
+		{"uniform": map[string]interface{}{"min": 150, "max": 100}},
+		{"normal": map[string]interface{}{"mean": 100, "stdDev": -1}},
+		{"lognormal": map[string]interface{}{"mu": 4, "sigma": -0.5}},
+		{"percentiles": map[string]interface{}{"p50": 100}},
+	} {
+		invalid := map[string]interface{}{
+			"protocol": "http",
+			"port":     4565,
+			"stubs":    []map[string]interface{}{stub("/invalid", wait)},
+		}
+		body, _ := json.Marshal(invalid)
+		resp, err := http.Post("http://localhost:2543/imposters", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Failed to post imposter: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for wait %v, got %d", wait, resp.StatusCode)
+		}
+	}
+
+	// Create imposter with function, distribution and long waits
+	imposterConfig := map[string]interface{}{
+		"protocol": "http",
+		"port":     4565,
+		"stubs": []map[string]interface{}{
+			stub("/fn", "function (config) { return Number(config.request.query.ms); }"),
+			stub("/uniform", map[string]interface{}{
+				"uniform": map[string]interface{}{"min": 100, "max": 150},
+				"seed":    42,
+			}),
+			stub("/percentiles", map[string]interface{}{
+				"percentiles": map[string]interface{}{"0": 120, "100": 120},
+			}),
+			stub("/slow", 10000),
+		},
+	}
+
+	body, _ := json.Marshal(imposterConfig)
+	resp, err := http.Post("http://localhost:2543/imposters", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create imposter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	timed := func(url string) time.Duration {
+		start := time.Now()
+		res, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", url, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 200 {
+			t.Errorf("Expected status 200 from %s, got %d", url, res.StatusCode)
+		}
+		return time.Since(start)
+	}
+
+	if elapsed := timed("http://localhost:4565/fn?ms=150"); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected function wait of about 150ms, took %v", elapsed)
+	}
+	if elapsed := timed("http://localhost:4565/uniform"); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected uniform wait between 100ms and 150ms, took %v", elapsed)
+	}
+	if elapsed := timed("http://localhost:4565/percentiles"); elapsed < 120*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected percentile wait of about 120ms, took %v", elapsed)
+	}
+
+	// Deleting the imposter interrupts pending waits
+	done := make(chan time.Duration, 1)
+	go func() {
+		start := time.Now()
+		if res, err := http.Get("http://localhost:4565/slow"); err == nil {
+			res.Body.Close()
+		}
+		done <- time.Since(start)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	req, _ := http.NewRequest("DELETE", "http://localhost:2543/imposters/4565", nil)
+	delResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to delete imposter: %v", err)
+	}
+	delResp.Body.Close()
+
+	select {
+	case elapsed := <-done:
+		if elapsed > 5*time.Second {
+			t.Errorf("Expected wait to be interrupted, took %v", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected wait to be interrupted when imposter was deleted")
+	}
+}